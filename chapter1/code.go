@@ -5,10 +5,21 @@ package chapter1
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"math/rand"
+	"runtime"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"concurrency_in_go/leaktest"
+	"concurrency_in_go/livelock"
+	"concurrency_in_go/lockorder"
+	"concurrency_in_go/locks"
+	"concurrency_in_go/racedetect"
+	"concurrency_in_go/sched"
 )
 
 /*
@@ -40,6 +51,47 @@ func memAccessSyncCase() {
 	}
 }
 
+// raceCondSched raceCondCase 在确定性调度器下的版本，打印的内容写入 printed
+// data++ 拆成读和写两步，每次访问 data 之前都是一个让出点，调度器决定谁先运行。
+func raceCondSched(printed *string) func(s *sched.Scheduler) {
+	return func(s *sched.Scheduler) {
+		*printed = ""
+		var data int
+		s.Go("increment", func() {
+			s.Yield()
+			v := data
+			s.Yield()
+			data = v + 1
+		})
+		s.Yield()
+		if data == 0 {
+			s.Yield()
+			*printed = fmt.Sprintf("the value is %v.", data)
+		}
+	}
+}
+
+// raceCondSchedCase 按照 cfg 运行一次 raceCondSched，相同的种子或者调度序列总是打印相同的内容
+func raceCondSchedCase(cfg sched.Config) (string, sched.Result) {
+	var printed string
+	r := sched.Run(cfg, raceCondSched(&printed))
+	return printed, r
+}
+
+// raceCondOutcomes 枚举 raceCondSched 所有的交错执行，返回每一种打印的内容和得到它的一次运行
+// 三种结果都可能出现：什么都不打印、打印 0，以及判断时为 0、打印时已经是 1。
+func raceCondOutcomes() map[string]sched.Result {
+	var printed string
+	outcomes := make(map[string]sched.Result)
+	sched.Enumerate(0, raceCondSched(&printed), func(r sched.Result) bool {
+		if _, ok := outcomes[printed]; !ok {
+			outcomes[printed] = r
+		}
+		return true
+	})
+	return outcomes
+}
+
 // memAccessSyncMtxCase： 内存访问同步之锁的应用
 func memAccessSyncMtxCase() {
 	var memAccess sync.Mutex
@@ -58,18 +110,86 @@ func memAccessSyncMtxCase() {
 	memAccess.Unlock()
 }
 
+// memAccessRaceCase 使用 racedetect 检查 memAccessSyncCase 和 memAccessSyncMtxCase 中对 data 的访问
+// 两个 goroutine 无论谁先运行，locked 为 false 时都会报告竞争；locked 为 true 时没有竞争。
+func memAccessRaceCase(locked bool) []*racedetect.Race {
+	d := racedetect.NewDetector(func(r *racedetect.Race) { fmt.Println(r) })
+	memAccess := d.NewMutex()
+	data := racedetect.NewVar(d, "data", 0)
+	lock := func() {
+		if locked {
+			memAccess.Lock()
+		}
+	}
+	unlock := func() {
+		if locked {
+			memAccess.Unlock()
+		}
+	}
+
+	var wg sync.WaitGroup // 只用来等待 goroutine 结束，没有插桩，不会建立 happens-before 关系
+	wg.Add(1)
+	d.Go("increment", func() {
+		defer wg.Done()
+		lock()
+		data.Store(data.Load() + 1)
+		unlock()
+	})
+	lock()
+	fmt.Printf("the value is %v.\n", data.Load())
+	unlock()
+	wg.Wait()
+	return d.Races()
+}
+
+// memAccessSyncCheck 使用 sched.Check 枚举 memAccessSyncMtxCase 的交错执行，locked 为 false 时去掉锁
+// 没有锁时两个虚拟 goroutine 可能同时将要访问 value，报告数据竞争和得到它的调度序列；有锁时没有失败。
+func memAccessSyncCheck(locked bool) sched.Report {
+	return sched.Check(sched.CheckConfig{Preemptions: 2}, func(s *sched.Scheduler) {
+		memAccess := s.NewMutex()
+		value := sched.NewVar(s, "value", 0)
+		lock := func() {
+			if locked {
+				memAccess.Lock()
+			}
+		}
+		unlock := func() {
+			if locked {
+				memAccess.Unlock()
+			}
+		}
+
+		s.Go("increment", func() {
+			lock()
+			value.Store(value.Load() + 1)
+			unlock()
+		})
+		lock()
+		v := value.Load()
+		s.Assert(v == 0 || v == 1, "the value is %v", v)
+		unlock()
+	})
+}
+
 // deadLockCase：死锁
 // 死锁程序是所有并发进程彼此等待的程序。在这种情况下
 // 没有外界的干预，这个程序将永远无法恢复。
-func deadLockCase() {
+// 书中的 sync.Mutex 无法放弃等待，这里使用 locks.Mutex，ctx 就是“外界的干预”：
+// 传入 context.Background() 时和书中一样永远等待，传入带超时的 ctx 时两次 printSum 都会放弃并返回错误。
+func deadLockCase(ctx context.Context) []error {
 	var wg sync.WaitGroup
-	printSum := func(v1, v2 *value) {
+	errs := make([]error, 2)
+	printSum := func(i int, v1, v2 *value) {
 		defer wg.Done()
-		v1.mtx.Lock()
+		if errs[i] = v1.mtx.LockContext(ctx); errs[i] != nil {
+			return
+		}
 		defer v1.mtx.Unlock()
 
-		time.Sleep(2 * time.Second)
-		v2.mtx.Lock()
+		time.Sleep(100 * time.Millisecond) // 保证两个 goroutine 都已经持有了第一个锁
+		if errs[i] = v2.mtx.LockContext(ctx); errs[i] != nil {
+			return
+		}
 		defer v2.mtx.Unlock()
 
 		fmt.Printf("sum=%v\n", v1.value+v2.value)
@@ -77,21 +197,120 @@ func deadLockCase() {
 
 	var a, b value
 	wg.Add(2)
-	go printSum(&a, &b)
-	go printSum(&b, &a)
+	go printSum(0, &a, &b)
+	go printSum(1, &b, &a)
 	/*
 	   第一次调用 printSum 锁定 a，然后试图锁定 b
 	   第二次调用 printSum 已锁定 b，并试图锁定 a
 	   这两个 gorountine 都无限等待
 	*/
 	wg.Wait()
+	return errs
+}
+
+// deadLockFreeCase 修复 deadLockCase 中的死锁
+// printSum 使用 locks.LockAll 同时获取两个锁，无论参数的顺序如何，锁总是按照相同的全局顺序获取，
+// 破坏了循环等待条件。
+func deadLockFreeCase(ctx context.Context) []error {
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	printSum := func(i int, v1, v2 *value) {
+		defer wg.Done()
+		var unlock func()
+		if unlock, errs[i] = locks.LockAll(ctx, &v1.mtx, &v2.mtx); errs[i] != nil {
+			return
+		}
+		defer unlock()
+
+		time.Sleep(100 * time.Millisecond)
+		fmt.Printf("sum=%v\n", v1.value+v2.value)
+	}
+
+	var a, b value
+	wg.Add(2)
+	go printSum(0, &a, &b)
+	go printSum(1, &b, &a)
+	wg.Wait()
+	return errs
+}
+
+// deadLockCheck 使用 sched.Check 枚举 deadLockCase 中两次 printSum 的交错执行
+// 以相反的顺序加锁时报告死锁和得到它的调度序列，不需要 time.Sleep 去凑巧；
+// ordered 为 true 时和 deadLockFreeCase 一样按照固定的顺序加锁，所有的交错执行都不会死锁。
+func deadLockCheck(ordered bool) sched.Report {
+	return sched.Check(sched.CheckConfig{Preemptions: 2}, func(s *sched.Scheduler) {
+		type value struct {
+			id    int
+			mtx   *sched.Mutex
+			value *sched.Var[int]
+		}
+		printSum := func(v1, v2 *value) {
+			if ordered && v2.id < v1.id {
+				v1, v2 = v2, v1
+			}
+			v1.mtx.Lock()
+			defer v1.mtx.Unlock()
+			v2.mtx.Lock()
+			defer v2.mtx.Unlock()
+			_ = v1.value.Load() + v2.value.Load()
+		}
+
+		a := &value{id: 1, mtx: s.NewMutex(), value: sched.NewVar(s, "a", 1)}
+		b := &value{id: 2, mtx: s.NewMutex(), value: sched.NewVar(s, "b", 2)}
+		wg := s.NewWaitGroup()
+		wg.Add(2)
+		s.Go("printSum(a, b)", func() {
+			defer wg.Done()
+			printSum(a, b)
+		})
+		s.Go("printSum(b, a)", func() {
+			defer wg.Done()
+			printSum(b, a)
+		})
+		wg.Wait()
+	})
 }
 
 type value struct {
-	mtx   sync.Mutex
+	mtx   locks.Mutex
 	value int
 }
 
+// deadLockDetectCase 使用 lockorder.Mutex 发现 deadLockCase 中的死锁
+// 两次 printSum 依次执行，这一次不会真的死锁，
+// 但是第二次调用以相反的顺序加锁时，lockorder 会报告加锁顺序的环和两次加锁的栈。
+func deadLockDetectCase() []*lockorder.Cycle {
+	detector := lockorder.NewDetector(func(c *lockorder.Cycle) {
+		fmt.Println(c)
+	})
+	type value struct {
+		mtx   sync.Locker
+		value int
+	}
+
+	var wg sync.WaitGroup
+	printSum := func(v1, v2 *value) {
+		defer wg.Done()
+		v1.mtx.Lock()
+		defer v1.mtx.Unlock()
+
+		v2.mtx.Lock()
+		defer v2.mtx.Unlock()
+
+		fmt.Printf("sum=%v\n", v1.value+v2.value)
+	}
+
+	a := value{mtx: detector.NewMutex("a")}
+	b := value{mtx: detector.NewMutex("b")}
+	wg.Add(1)
+	go printSum(&a, &b)
+	wg.Wait() // 等待第一次调用结束，避免真的死锁
+	wg.Add(1)
+	go printSum(&b, &a)
+	wg.Wait()
+	return detector.Cycles()
+}
+
 /*
 
     构成死锁的 Conffman 条件：
@@ -109,9 +328,18 @@ type value struct {
 func liveLockCase() {
 	cadence := sync.NewCond(&sync.Mutex{})
 
+	done := make(chan struct{})
+	defer close(done) // 停止节拍，否则这个 goroutine 会一直泄漏下去
 	go func() {
-		for range time.Tick(1 * time.Microsecond) {
-			cadence.Broadcast() // sync.Cond{}.Broadcast() 函数，
+		ticker := time.NewTicker(1 * time.Microsecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				cadence.Broadcast() // sync.Cond{}.Broadcast() 函数，
+			}
 		}
 	}()
 
@@ -165,18 +393,176 @@ func liveLockCase() {
 	peopleInHallway.Wait()
 }
 
+// lockstep 代替 liveLockCase 中按时钟广播的节拍，让走廊里的人确定地步调一致
+// 每一步都要等所有在走廊里的人都走到这一步才能继续；退避的人先离开，回来之后再加入。
+type lockstep struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	parties int // 在走廊里的人数
+	waiting int // 已经走到这一步的人数
+	gen     int // 第几步
+	stopped bool
+}
+
+// newLockstep 返回一开始就有 parties 个人在走廊里的 lockstep
+func newLockstep(parties int) *lockstep {
+	s := &lockstep{parties: parties}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// step 等待其他人走到同一步，stop 之后直接返回
+func (s *lockstep) step() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return
+	}
+	s.waiting++
+	if s.waiting == s.parties {
+		s.advance()
+		return
+	}
+	for gen := s.gen; gen == s.gen && !s.stopped; {
+		s.cond.Wait()
+	}
+}
+
+func (s *lockstep) join() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.parties++
+}
+
+// leave 离开走廊，留下的人都已经走到这一步时不用再等离开的人
+func (s *lockstep) leave() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.parties--
+	if s.waiting > 0 && s.waiting == s.parties {
+		s.advance()
+	}
+}
+
+func (s *lockstep) advance() {
+	s.waiting = 0
+	s.gen++
+	s.cond.Broadcast()
+}
+
+func (s *lockstep) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = true
+	s.cond.Broadcast()
+}
+
+// hallwayCase 使用退避解决 liveLockCase 中的活锁
+// 两个人不断尝试，直到通过走廊或者被取消，每次尝试都向 livelock.Monitor 报告忙碌，通过时报告进展。
+// withBackoff 为 false 时两个人通过 lockstep 每一步都步调一致，一定会发生活锁，Monitor 发现之后取消模拟；
+// withBackoff 为 true 时每次失败之后离开走廊随机退避一段时间，步调被打乱，两个人很快都能通过。
+// 返回每个人通过走廊用的尝试次数（被取消的人为 -1）以及 Monitor 报告的活锁。
+func hallwayCase(withBackoff bool) (map[string]int, []livelock.Stall) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	steps := newLockstep(2) // 两个人同时进入走廊
+	go func() {
+		<-ctx.Done()
+		steps.stop() // 唤醒还在等待其他人的人
+	}()
+	takeStep := steps.step
+
+	tryDir := func(dir *int32) bool {
+		atomic.AddInt32(dir, 1)
+		takeStep()
+		if atomic.LoadInt32(dir) == 1 {
+			return true
+		}
+		takeStep()
+		atomic.AddInt32(dir, -1)
+		return false
+	}
+	var left, right int32
+
+	// 忙碌了 500ms 却没有人通过，就认为发生了活锁，取消模拟
+	monitor := livelock.NewMonitor(500 * time.Millisecond)
+	var stalls []livelock.Stall
+	watched := make(chan struct{})
+	go func() {
+		defer close(watched)
+		for stall := range monitor.Watch(ctx.Done(), 10*time.Millisecond) {
+			fmt.Printf("%v is livelocked after %v attempts\n", stall.Worker, stall.Busy)
+			stalls = append(stalls, stall)
+			cancel()
+		}
+	}()
+
+	var mu sync.Mutex
+	attempts := make(map[string]int)
+	walk := func(walking *sync.WaitGroup, name string, seed int64) {
+		defer walking.Done()
+		tracker := monitor.Track(name)
+		defer monitor.Untrack(name)
+		defer steps.leave()
+		backoff := livelock.Backoff{Base: time.Millisecond, Max: 10 * time.Millisecond, Rand: rand.New(rand.NewSource(seed))}
+
+		result := -1
+		defer func() {
+			mu.Lock()
+			defer mu.Unlock()
+			attempts[name] = result
+		}()
+		for attempt := 1; ctx.Err() == nil; attempt++ {
+			tracker.Busy()
+			// 取消之后 lockstep 不再同步步伐，这时的“通过”不算数
+			if (tryDir(&left) || tryDir(&right)) && ctx.Err() == nil {
+				tracker.Progress()
+				fmt.Printf("%v scooted after %v attempts\n", name, attempt)
+				result = attempt
+				return
+			}
+			if withBackoff {
+				steps.leave()
+				select {
+				case <-ctx.Done():
+				case <-time.After(backoff.Delay(attempt)):
+				}
+				steps.join()
+			}
+		}
+		fmt.Printf("%v tosses her hands up in exaspertion!\n", name)
+	}
+
+	var peopleInHallway sync.WaitGroup
+	peopleInHallway.Add(2)
+	go walk(&peopleInHallway, "Alice", 1)
+	go walk(&peopleInHallway, "Barbara", 2)
+	peopleInHallway.Wait()
+
+	cancel()
+	<-watched
+	return attempts, stalls
+}
+
 // starvationCase 饥饿
 // 饥饿是在任何情况下，并发进程都无法获得执行工作所需的所有资源
-func starvationCase() {
+// 贪婪的 worker 每次循环持有一次锁，礼貌的 worker 每次循环获取三次锁，两者的工作量相同。
+// shareLock 被 locks.Metered 包装，返回每个 worker 等待和持有锁的统计。
+func starvationCase(shareLock sync.Locker, runtime time.Duration) *locks.Metered {
 	var wg sync.WaitGroup
-	var shareLock sync.Mutex
-	const runtime = 5 * time.Second
+	metered := locks.NewMetered(shareLock)
+
+	// 两个 worker 同时开始、同时结束，整个过程中都在竞争锁
+	start := make(chan struct{})
+	var deadline time.Time // 在 close(start) 之前写入
 
 	greedWorker := func() {
 		defer wg.Done()
+		shareLock := metered.For("greedy")
 
 		var count int
-		for begin := time.Now(); time.Since(begin) < runtime; {
+		for <-start; time.Now().Before(deadline); {
 			shareLock.Lock()
 			time.Sleep(3 * time.Nanosecond)
 			shareLock.Unlock()
@@ -187,9 +573,10 @@ func starvationCase() {
 
 	politeWorker := func() {
 		defer wg.Done()
+		shareLock := metered.For("polite")
 
 		var count int
-		for begin := time.Now(); time.Since(begin) <= runtime; {
+		for <-start; time.Now().Before(deadline); {
 			shareLock.Lock()
 			time.Sleep(1 * time.Nanosecond)
 			shareLock.Unlock()
@@ -210,6 +597,73 @@ func starvationCase() {
 	wg.Add(2)
 	go greedWorker()
 	go politeWorker()
+	deadline = time.Now().Add(runtime)
+	close(start)
 
 	wg.Wait()
+	return metered
+}
+
+// starvationCompareCase 分别使用 sync.Mutex 和 locks.TicketMutex 运行 starvationCase 并打印报告
+// 两种锁下两个 worker 获取锁的次数都接近，贪婪的 worker 完成的循环都大约是礼貌的 worker 的 3 倍：
+// 礼貌的 worker 每次循环要获取三次锁，公平的锁只让获取锁的机会均等，不让工作量均等。
+// sync.Mutex 中等待超过 1ms 的 goroutine 会让锁进入饥饿模式直接交接，也不会长时间饥饿，
+// 所以这个按时间运行的实验区分不出两种锁，两者的区别见 handoffCase。
+func starvationCompareCase(runtime time.Duration) (mutex, ticket map[string]locks.HolderStats) {
+	fmt.Println("sync.Mutex:")
+	m := starvationCase(&sync.Mutex{}, runtime)
+	fmt.Print(m.Report())
+
+	fmt.Println("locks.TicketMutex:")
+	t := starvationCase(&locks.TicketMutex{}, runtime)
+	fmt.Print(t.Report())
+	return m.Stats(), t.Stats()
+}
+
+// handoffCase 比较 l 释放时是否交给已经在等待的 goroutine
+// 每一轮中当前 goroutine 持有锁，等另一个 goroutine 阻塞在 Lock 上之后释放锁并立即重新获取，
+// 记录谁先获取到锁，返回等待者先获取到锁的轮数。
+// TicketMutex 每一轮都交给等待者；sync.Mutex 在正常模式下允许刚释放锁的 goroutine 抢先，
+// 被唤醒的等待者几乎总是晚一步。
+func handoffCase(l sync.Locker, rounds int) int {
+	handoffs := 0
+	for i := 0; i < rounds; i++ {
+		var first string // 只在持有 l 时访问
+		l.Lock()
+		waited := make(chan struct{})
+		go func() {
+			defer close(waited)
+			l.Lock()
+			if first == "" {
+				first = "waiter"
+			}
+			l.Unlock()
+		}()
+		awaitBlocked("chapter1.handoffCase.func1")
+
+		l.Unlock()
+		l.Lock()
+		if first == "" {
+			first = "releaser"
+		}
+		l.Unlock()
+		<-waited
+		if first == "waiter" {
+			handoffs++
+		}
+	}
+	return handoffs
+}
+
+// awaitBlocked 等待栈中有 fn 的 goroutine 阻塞
+// 阻塞的时间要尽量短：sync.Mutex 的等待者超过 1ms 之后锁会进入饥饿模式，直接交给等待者。
+func awaitBlocked(fn string) {
+	for {
+		for _, g := range leaktest.Take() {
+			if strings.Contains(g.Stack, fn) && g.State != "runnable" && g.State != "running" {
+				return
+			}
+		}
+		runtime.Gosched()
+	}
 }
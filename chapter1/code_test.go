@@ -1,11 +1,22 @@
 package chapter1
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"concurrency_in_go/leaktest"
+	"concurrency_in_go/locks"
+	"concurrency_in_go/sched"
+)
 
 /*
 go test -v -count=1 ./chapter1 -run TestRaceCondCase
 */
 func TestRaceCondCase(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
 	raceCondCase()
 }
 
@@ -13,33 +24,193 @@ func TestRaceCondCase(t *testing.T) {
 go test -v -count=1 ./chapter1 -run TestMemAccessSyncCase
 */
 func TestMemAccessSyncCase(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
 	memAccessSyncCase()
 }
 
+/*
+go test -v -count=1 ./chapter1 -run TestRaceCondSchedCase
+*/
+// TestRaceCondSchedCase 枚举得到 raceCondCase 所有可能的输出，每一种都可以按照调度序列精确地重现
+func TestRaceCondSchedCase(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
+
+	outcomes := raceCondOutcomes()
+	for _, want := range []string{"", "the value is 0.", "the value is 1."} {
+		r, ok := outcomes[want]
+		if !ok {
+			t.Fatalf("outcome %q not found in %v", want, outcomes)
+		}
+		if got, _ := raceCondSchedCase(sched.Config{Schedule: r.Schedule}); got != want {
+			t.Errorf("replay of %v printed %q, want %q", r.Schedule, got, want)
+		}
+	}
+
+	for seed := int64(1); seed <= 10; seed++ {
+		first, _ := raceCondSchedCase(sched.Config{Seed: seed})
+		second, _ := raceCondSchedCase(sched.Config{Seed: seed})
+		if first != second {
+			t.Errorf("seed %d printed %q then %q", seed, first, second)
+		}
+	}
+}
+
 /*
 go test -v -count=1 ./chapter1 -run TestMemAccessSyncMtxCase
 */
 func TestMemAccessSyncMtxCase(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
 	memAccessSyncMtxCase()
 }
 
+/*
+go test -v -count=1 ./chapter1 -run TestMemAccessRaceCase
+*/
+func TestMemAccessRaceCase(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
+
+	if races := memAccessRaceCase(false); len(races) == 0 || races[0].Var != "data" {
+		t.Fatalf("without lock: got %v, want a race on data", races)
+	}
+	if races := memAccessRaceCase(true); len(races) != 0 {
+		t.Fatalf("with lock: got %v", races)
+	}
+}
+
+/*
+go test -v -count=1 ./chapter1 -run TestMemAccessSyncCheck
+*/
+func TestMemAccessSyncCheck(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
+
+	report := memAccessSyncCheck(false)
+	if !report.Failed() || !errors.Is(report.Failures[0].Err, sched.ErrRace) {
+		t.Fatalf("without lock: %v", report)
+	}
+	t.Logf("without lock: %v", report)
+
+	if report := memAccessSyncCheck(true); report.Failed() || !report.Complete {
+		t.Fatalf("with lock: %v", report)
+	}
+}
+
 /*
 go test -v -count=1 ./chapter1 -run TestDeadLockCase
 */
+// TestDeadLockCase 死锁的版本在超时之前无法完成，修复之后的版本可以完成
 func TestDeadLockCase(t *testing.T) {
-	deadLockCase()
+	leaktest.VerifyNoLeaks(t)
+
+	t.Run("deadlock", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		for i, err := range deadLockCase(ctx) {
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("printSum %d: got %v, want DeadlineExceeded", i, err)
+			}
+		}
+	})
+	t.Run("fixed", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		for i, err := range deadLockFreeCase(ctx) {
+			if err != nil {
+				t.Errorf("printSum %d: %v", i, err)
+			}
+		}
+	})
+}
+
+/*
+go test -v -count=1 ./chapter1 -run TestDeadLockCheck
+*/
+// TestDeadLockCheck 相反的加锁顺序在某个交错执行中死锁，按照固定顺序加锁之后所有的交错执行都可以完成
+func TestDeadLockCheck(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
+
+	report := deadLockCheck(false)
+	if len(report.Failures) != 1 || !errors.Is(report.Failures[0].Err, sched.ErrDeadlock) {
+		t.Fatalf("reversed order: %v", report)
+	}
+	t.Logf("reversed order: %v", report)
+
+	if report := deadLockCheck(true); report.Failed() || !report.Complete {
+		t.Fatalf("fixed order: %v", report)
+	}
+}
+
+/*
+go test -v -count=1 ./chapter1 -run TestDeadLockDetectCase
+*/
+func TestDeadLockDetectCase(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
+	cycles := deadLockDetectCase()
+	if len(cycles) != 1 {
+		t.Fatalf("got %d lock order cycles, want 1", len(cycles))
+	}
+	if got := cycles[0].Locks; len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Fatalf("got cycle %v, want a -> b -> a", got)
+	}
 }
 
 /*
 go test -count=1 -v ./chapter1 -run TestLiveLockCase
 */
 func TestLiveLockCase(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
 	liveLockCase()
 }
 
+/*
+go test -count=1 -v ./chapter1 -run TestHallwayCase
+*/
+func TestHallwayCase(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
+
+	t.Run("backoff", func(t *testing.T) {
+		attempts, stalls := hallwayCase(true)
+		for _, name := range []string{"Alice", "Barbara"} {
+			if attempts[name] < 1 {
+				t.Errorf("%v did not get through the hallway", name)
+			}
+		}
+		if len(stalls) != 0 {
+			t.Errorf("livelock reported with backoff: %+v", stalls)
+		}
+		t.Logf("attempts with backoff: %v", attempts)
+	})
+	t.Run("livelock", func(t *testing.T) {
+		attempts, stalls := hallwayCase(false)
+		if attempts["Alice"] != -1 || attempts["Barbara"] != -1 {
+			t.Fatalf("someone got through in lockstep: %v", attempts)
+		}
+		if len(stalls) == 0 {
+			t.Fatalf("both gave up without a livelock report: %v", attempts)
+		}
+	})
+}
+
 /*
 go test -count=1 -v ./chapter1 -run TestStarvationCase
 */
+// TestStarvationCase 按时间运行的实验中两种锁都能让两个 worker 持续获取锁；
+// 锁释放时有等待者的情况下，只有 TicketMutex 每次都把锁交给等待者。
 func TestStarvationCase(t *testing.T) {
-	starvationCase()
+	leaktest.VerifyNoLeaks(t)
+	mutex, ticket := starvationCompareCase(time.Second)
+	for name, stats := range map[string]map[string]locks.HolderStats{"sync.Mutex": mutex, "TicketMutex": ticket} {
+		if stats["greedy"].Acquisitions == 0 || stats["polite"].Acquisitions == 0 {
+			t.Fatalf("%s: a worker never acquired the lock: %+v", name, stats)
+		}
+	}
+
+	const rounds = 100
+	if got := handoffCase(&locks.TicketMutex{}, rounds); got != rounds {
+		t.Fatalf("TicketMutex handed off to the waiter in %d of %d rounds, want all", got, rounds)
+	}
+	got := handoffCase(&sync.Mutex{}, rounds)
+	if got == rounds {
+		t.Fatalf("sync.Mutex handed off to the waiter in all %d rounds, want the releaser to barge in sometimes", rounds)
+	}
+	t.Logf("sync.Mutex handed off to the waiter in %d of %d rounds", got, rounds)
 }
@@ -15,6 +15,8 @@ import (
 	"testing"
 	"text/tabwriter"
 	"time"
+
+	"concurrency_in_go/lockprof"
 )
 
 /*
@@ -43,6 +45,7 @@ M 个绿色线程映射到 N 个 OS 线程。然后 gorountine 安排在
     Go 语言遵循一个成为 fork-join 的并发模型。
 fork 指的是在程序中任意一点，它可以将执行的子分支与其父节点同时运行。
 join 指的是在将来某个时候，这些并发的执行分支将会合并在一起。
+    运行时如何通过工作窃取调度 fork-join 的任务见第六章和 forkjoin 包。
 */
 
 // syncExample sync 包 demo
@@ -325,6 +328,50 @@ func mutexExample2() {
 	}
 }
 
+// mutexProfileExample
+// 与 mutexExample2 相同的生产者和观察者，使用 lockprof 记录锁的竞争情况
+// 生产者持有写锁，观察者持有读锁，返回读写锁的统计并以 JSON 格式打印。
+// 观察者同时持有读锁，生产者的第一次写锁一定会和它们竞争。
+func mutexProfileExample(observers int) lockprof.Snapshot {
+	profile := lockprof.NewProfile("mutexExample2", lockprof.Options{})
+	m := profile.NewRWMutex()
+
+	producer := func(wg *sync.WaitGroup, l sync.Locker) {
+		defer wg.Done()
+		for i := 5; i > 0; i-- {
+			l.Lock()
+			l.Unlock()
+			time.Sleep(time.Millisecond)
+		}
+	}
+	// 所有观察者都持有读锁之后才启动生产者：等待中的写锁会阻塞新的读锁，
+	// 先启动生产者的话，持有读锁等待其他观察者的一方会和生产者互相等待
+	var reading sync.WaitGroup
+	reading.Add(observers)
+	observer := func(wg *sync.WaitGroup, l sync.Locker) {
+		defer wg.Done()
+		l.Lock()
+		defer l.Unlock()
+		reading.Done()
+		reading.Wait()
+		time.Sleep(time.Millisecond) // 模拟读取
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(observers + 1)
+	for i := observers; i > 0; i-- {
+		go observer(&wg, m.RLocker())
+	}
+	reading.Wait()
+	go producer(&wg, m)
+	wg.Wait()
+
+	if err := profile.WriteJSON(os.Stdout); err != nil {
+		log.Printf("cannot write profile: %v", err)
+	}
+	return profile.Snapshot()
+}
+
 // condExample
 // Cond 类型，一个 gorountine 的集合点，等待或发布一个 event
 // 一个 "event" 是两个或两个以上的 gorountine 之间的任意信号
@@ -1,11 +1,16 @@
 package chapter3
 
-import "testing"
+import (
+	"testing"
+
+	"concurrency_in_go/leaktest"
+)
 
 /*
 go test ./chapter3 -v -count=1 -run TestChanExmaple9
 */
 func TestChanExmaple9(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
 	chanExample9()
 }
 
@@ -13,6 +18,7 @@ func TestChanExmaple9(t *testing.T) {
 go test ./chapter3 -v -count=1 -run TestSelectExample2
 */
 func TestSelectExample2(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
 	selectExample2()
 }
 
@@ -20,6 +26,7 @@ func TestSelectExample2(t *testing.T) {
 go test ./chapter3 -v -count=1 -run TestSelectExample3
 */
 func TestSelectExample3(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
 	selectExample3()
 }
 
@@ -27,5 +34,23 @@ func TestSelectExample3(t *testing.T) {
 go test ./chapter3 -v -count=1 -run TestSelectExample6
 */
 func TestSelectExample6(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
 	selectExample6()
 }
+
+/*
+go test ./chapter3 -v -count=1 -run TestMutexProfileExample
+*/
+func TestMutexProfileExample(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
+	s := mutexProfileExample(100)
+	if s.Writes.Acquired != 5 || s.Reads.Acquired != 100 {
+		t.Fatalf("got %d writes %d reads, want 5 and 100", s.Writes.Acquired, s.Reads.Acquired)
+	}
+	if s.MaxReaders != 100 {
+		t.Fatalf("max readers %d, want all 100 observers to hold the read lock together", s.MaxReaders)
+	}
+	if s.Writes.Contended == 0 || len(s.Stacks) == 0 {
+		t.Fatalf("producer did not contend with the observers: %+v", s.Writes)
+	}
+}
@@ -5,12 +5,16 @@ package chapter4
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"net/http"
 	"runtime"
 	"sync"
 	"time"
+
+	"concurrency_in_go/pipeline"
 )
 
 // "特定约束"举例
@@ -266,55 +270,31 @@ func forSelectExample7() {
 }
 
 // orChannelExample
-// 通过递归和 goroutine 创建一个复合 done channel
 // 可以将任意数量的 channel 组合到单个 channel 中，
 // 只要任何组件 channel 关闭或写入，该 channel 就会关闭。
 // 本例将经过一段时间后关闭channel，并将这些 channel 合并到一个关闭的单个 channel 中。
+// 书中的 or 通过递归和 goroutine 创建一个复合 done channel，每三个 channel 创建一个 goroutine，
+// 而 pipeline.Or 使用 reflect.Select 在一个 goroutine 中等待所有的 channel。
 func orChannelExample() {
-	var or func(channels ...<-chan interface{}) <-chan interface{}
-
-	or = func(channels ...<-chan interface{}) <-chan interface{} {
-		switch len(channels) { // 递归函数的终止条件
-		case 0:
-			return nil
-		case 1:
-			return channels[0]
-		}
+	done := make(chan struct{})
+	defer close(done) // 结束时让其他还在等待的 sig goroutine 退出
 
-		orDone := make(chan interface{})
-		go func() { // 函数主体
-			defer close(orDone)
-			switch len(channels) {
-			case 2:
-				select {
-				case <-channels[0]:
-				case <-channels[1]:
-				}
-			default:
-				select {
-				case <-channels[0]:
-				case <-channels[1]:
-				case <-channels[2]:
-				case <-or(append(channels[:3], orDone)...):
-				}
-			}
-		}()
-		return orDone
-	}
-
-	sig := func(after time.Duration) <-chan interface{} {
+	sig := func(after time.Duration) <-chan struct{} {
 		// 创建一个channle，等待指定时间后关闭。
-		c := make(chan interface{})
+		c := make(chan struct{})
 		go func() {
 			defer close(c)
-			time.Sleep(after)
+			select {
+			case <-time.After(after):
+			case <-done:
+			}
 		}()
 		return c
 	}
 
 	start := time.Now() // 大致追踪 or 函数的 channel 何时开始阻塞
 
-	<-or(
+	<-pipeline.Or(
 		sig(2*time.Hour),
 		sig(5*time.Minute),
 		sig(1*time.Second),
@@ -334,7 +314,7 @@ func orChannelExample() {
 */
 // errHandleExample
 // 简单的错误处理示例
-func errHandleExample() {
+func errHandleExample(urls ...string) {
 	checkStatus := func(done <-chan interface{}, urls ...string) <-chan *http.Response {
 		responses := make(chan *http.Response)
 		go func() {
@@ -358,95 +338,72 @@ func errHandleExample() {
 	done := make(chan interface{})
 	defer close(done)
 
-	urls := []string{"https://www.baidu.com", "https://badhost"}
 	for response := range checkStatus(done, urls...) {
 		fmt.Printf("Response: %v\n", response.Status)
+		response.Body.Close()
 	}
 }
 
-//errHandleExample2
-// 上面示例的更佳的解决方案
-func errHandleExample2() {
-	type Result struct {
-		Error    error
-		Response *http.Response
+// getStatus 请求 url，关闭响应体之后返回状态
+// 响应体不关闭，连接就不能被复用，会一直泄漏下去。
+func getStatus(url string) (string, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", err
 	}
+	defer resp.Body.Close()
+	return resp.Status, nil
+}
 
-	checkStatus := func(done <-chan interface{}, urls ...string) <-chan Result {
-		results := make(chan Result)
-		go func() {
-			defer close(results)
-			for _, url := range urls {
-				var result Result
-				resp, err := http.Get(url)
-				result = Result{Error: err, Response: resp}
-				select {
-				case <-done:
-					return
-				case results <- result: // 请求的结果返回
-				}
-			}
-		}()
-		return results
+//errHandleExample2
+// 上面示例的更佳的解决方案
+// 使用 pipeline.Result 将响应和错误结合在一起返回
+func errHandleExample2(urls ...string) {
+	checkStatus := func(done <-chan struct{}, urls ...string) <-chan pipeline.Result[string] {
+		// 请求的结果和错误通过同一个 channel 返回
+		return pipeline.Try(done, pipeline.Generator(done, urls...), getStatus)
 	}
 
-	done := make(chan interface{})
+	done := make(chan struct{})
 	defer close(done)
-	urls := []string{"https://www.baidu.com", "https://badhost"}
 	for result := range checkStatus(done, urls...) {
-		if result.Error != nil {
-			fmt.Printf("error: %v", result.Error)
+		if result.Err != nil {
+			fmt.Printf("error: %v", result.Err)
 			continue
 		}
-		fmt.Printf("Response: %v\n", result.Response.Status)
+		fmt.Printf("Response: %v\n", result.Value)
 	}
 }
 
 // errHandleExample3
 // 上面示例的修改版
-func errHandleExample3() {
-	done := make(chan interface{})
+// 错误超过 3 个时停止，不需要在每个调用方重复 errCount >= 3 的循环，
+// 使用 pipeline.MaxErrors 策略包装 Result 流即可。
+func errHandleExample3(urls ...string) {
+	done := make(chan struct{})
 	defer close(done)
 
-	type Result struct {
-		Error    error
-		Response *http.Response
-	}
-
-	checkStatus := func(done <-chan interface{}, urls ...string) <-chan Result {
-		results := make(chan Result)
-		go func() {
-			defer close(results)
-			for _, url := range urls {
-				var result Result
-				resp, err := http.Get(url)
-				result = Result{Error: err, Response: resp}
-				select {
-				case <-done:
-					return
-				case results <- result: // 请求的结果返回
-				}
-			}
-		}()
-		return results
+	checkStatus := func(done <-chan struct{}, urls ...string) <-chan pipeline.Result[string] {
+		return pipeline.Try(done, pipeline.Generator(done, urls...), getStatus)
 	}
 
-	errCount := 0
-	urls := []string{"a", "https://www.baidu.com", "b", "c", "d"}
-	for result := range checkStatus(done, urls...) {
-		if result.Error != nil {
-			fmt.Printf("error: %v\n", result.Error)
-			errCount++
-			if errCount >= 3 { // 错误超过3个时，跳出 range 循环
-				fmt.Println("Too many errors, breaking!")
-				break
-			}
+	results := pipeline.WithPolicy(done, checkStatus(done, urls...), pipeline.MaxErrors(3))
+	for result := range results {
+		if errors.Is(result.Err, pipeline.ErrTooManyErrors) { // 错误达到 3 个时，Result 流结束
+			fmt.Printf("error: %v\n", result.Err)
+			fmt.Println("Too many errors, breaking!")
+			break
+		}
+		if result.Err != nil {
+			fmt.Printf("error: %v\n", result.Err)
 			continue
 		}
-		fmt.Printf("Response: %v\n", result.Response.Status)
+		fmt.Printf("Response: %v\n", result.Value)
 	}
 }
 
+// 完整的 checkStatus 实现（worker 池、超时、重试、关闭响应体）见 urlcheck 包。
+
 // 在构建 goroutine 的返回值时，应将错误视为一等公民。
 // 如果你的 goroutine 可能产生错误，那么这些错误应该与你的结果类型紧密结合
 // 并且通过相同的通信线传递，就像常规的同步函数。
@@ -585,165 +542,56 @@ func pipelineExample3() {
 /*
 	一些便利的生成器
 */
+// repeat、take、repeatFn、orDone、tee、bridge、fanIn 这些 stage 都已经
+// 抽取到 pipeline 包中，下面的示例直接使用泛型版本。
 
 // generatorExample
-func generatorExample() {
-	repeat := func(done <-chan interface{}, values ...interface{}) <-chan interface{} {
-		valueStream := make(chan interface{})
-		go func() {
-			defer close(valueStream)
-			for {
-				for _, v := range values {
-					select {
-					case <-done:
-						return
-					case valueStream <- v:
-					}
-				}
-			}
-		}()
-		return valueStream
-	}
-
-	take := func( // 只会从其传入的 valueStream 中取出第一个 num 项目
-		done <-chan interface{},
-		valueStream <-chan interface{},
-		num int) <-chan interface{} {
-		takeStream := make(chan interface{})
-		go func() {
-			defer close(takeStream)
-			for i := 0; i < num; i++ {
-				select {
-				case <-done:
-					return
-				case takeStream <- valueStream:
-				}
-			}
-		}()
-		return takeStream
-	}
-
-	done := make(chan interface{})
+// pipeline.Take 只会从其传入的 valueStream 中取出第一个 num 项目
+// 书中的 take 写成了 takeStream <- valueStream，发送的是 channel 本身而不是其中的值，
+// 正确的写法是 takeStream <- <-valueStream。
+func generatorExample() []int {
+	done := make(chan struct{})
 	defer close(done)
 
-	for num := range take(done, repeat(done, 1), 10) {
+	var nums []int
+	for num := range pipeline.Take(done, pipeline.Repeat(done, 1), 10) {
 		fmt.Printf("%+v ", num)
+		nums = append(nums, num)
 	}
+	return nums
 }
 
 // generatorExample2
 // 重复调用函数的生成器
-func generatorExample2() {
-	take := func( // 只会从其传入的 valueStream 中取出第一个 num 项目
-		done <-chan interface{},
-		valueStream <-chan interface{},
-		num int) <-chan interface{} {
-		takeStream := make(chan interface{})
-		go func() {
-			defer close(takeStream)
-			for i := 0; i < num; i++ {
-				select {
-				case <-done:
-					return
-				case takeStream <- valueStream:
-				}
-			}
-		}()
-		return takeStream
-	}
-
-	repeatFn := func(
-		done <-chan interface{},
-		fn func() interface{},
-	) <-chan interface{} {
-		valueStream := make(chan interface{})
-		go func() {
-			defer close(valueStream)
-			for {
-				select {
-				case <-done:
-					return
-				case valueStream <- fn():
-				}
-			}
-		}()
-		return valueStream
-	}
-
-	done := make(chan interface{})
+func generatorExample2() []int {
+	done := make(chan struct{})
 	defer close(done)
 
-	rand := func() interface{} { return rand.Int() }
+	rand := func() int { return rand.Int() }
 
-	for num := range take(done, repeatFn(done, rand), 10) {
+	var nums []int
+	for num := range pipeline.Take(done, pipeline.RepeatFn(done, rand), 10) {
 		fmt.Println(num)
+		nums = append(nums, num)
 	}
 	// 根据需要生成随机整数的无限 channel
+	return nums
 }
 
 // forSelectExample8
-func forSelectExample8() {
-	repeat := func(done <-chan interface{}, values ...interface{}) <-chan interface{} {
-		valueStream := make(chan interface{})
-		go func() {
-			defer close(valueStream)
-			for {
-				for _, v := range values {
-					select {
-					case <-done:
-						return
-					case valueStream <- v:
-					}
-				}
-			}
-		}()
-		return valueStream
-	}
-
-	take := func( // 只会从其传入的 valueStream 中取出第一个 num 项目
-		done <-chan interface{},
-		valueStream <-chan interface{},
-		num int) <-chan interface{} {
-		takeStream := make(chan interface{})
-		go func() {
-			defer close(takeStream)
-			for i := 0; i < num; i++ {
-				select {
-				case <-done:
-					return
-				case takeStream <- valueStream:
-				}
-			}
-		}()
-		return takeStream
-	}
-	toString := func(done <-chan interface{},
-		valueStream <-chan interface{}) <-chan string {
-		stringStream := make(chan string)
-		go func() {
-			defer close(stringStream)
-			for v := range valueStream {
-				select {
-				case <-done:
-					return
-				case stringStream <- v.(string):
-				}
-			}
-		}()
-		return stringStream
-	}
-
-	done := make(chan interface{})
+// 泛型版本的 Repeat 直接返回 <-chan string，不再需要 toString 做类型断言
+func forSelectExample8() string {
+	done := make(chan struct{})
 	defer close(done)
 
 	var message string
-	for token := range toString(done, take(done, repeat(done, "I", "am."), 5)) {
+	for token := range pipeline.Take(done, pipeline.Repeat(done, "I", "am."), 5) {
 		message += token
 	}
 	fmt.Printf("message: %s...", message)
+	return message
 }
 
-// TODO: the testFunc shows a bug
 /*
 	扇入，扇出/ Fan-in, Fan-out
 */
@@ -751,59 +599,11 @@ func forSelectExample8() {
 // 扇入: 是将多个结果组合到一个 channel 的过程。
 // 举例: 用于寻找素数的低效程序
 func fanInFanOutExmaple() {
-
-	// repeatFn: 重复 fn 函数
-	repeatFn := func(done <-chan interface{}, fn func() interface{}) <-chan interface{} {
-		valueStream := make(chan interface{})
-		go func() {
-			defer close(valueStream)
-			for {
-				select {
-				case <-done:
-					return
-				case valueStream <- fn():
-				}
-			}
-		}()
-		return valueStream
-	}
-
-	// take
-	take := func(done <-chan interface{}, valueStream <-chan interface{}, num int,
-	) <-chan interface{} {
-		takeStream := make(chan interface{})
-		go func() {
-			defer close(takeStream)
-			for i := 0; i < num; i++ {
-				select {
-				case <-done:
-					return
-				case takeStream <- <-valueStream:
-				}
-			}
-		}()
-		return takeStream
-	}
-
-	toInt := func(done <-chan interface{}, valueStream <-chan interface{}) <-chan int {
-		intStream := make(chan int)
-		go func() {
-			defer close(intStream)
-			for v := range valueStream {
-				select {
-				case <-done:
-					return
-				case intStream <- v.(int):
-				}
-			}
-		}()
-		return intStream
-	}
-	primeFinder := func(done <-chan interface{}, intStream <-chan int) <-chan interface{} {
-		primeStream := make(chan interface{})
+	primeFinder := func(done <-chan struct{}, intStream <-chan int) <-chan int {
+		primeStream := make(chan int)
 		go func() {
 			defer close(primeStream)
-			for integer := range intStream {
+			for integer := range pipeline.OrDone(done, intStream) {
 				integer -= 1
 				prime := true
 				for divisor := integer - 1; divisor > 1; divisor-- {
@@ -824,91 +624,111 @@ func fanInFanOutExmaple() {
 		}()
 		return primeStream
 	}
-	fanIn := func(done <-chan interface{}, channels ...<-chan interface{}) <-chan interface{} {
-		var wg sync.WaitGroup
-		multiplexedStream := make(chan interface{})
-
-		multiplex := func(c <-chan interface{}) {
-			defer wg.Done()
-			for i := range c {
-				select {
-				case <-done:
-					return
-				case multiplexedStream <- i:
-				}
-			}
-		}
-
-		wg.Add(len(channels))
-		for _, c := range channels {
-			go multiplex(c)
-		}
-
-		go func() {
-			wg.Wait()
-			close(multiplexedStream)
-		}()
-
-		return multiplexedStream
-	}
 
-	done := make(chan interface{})
+	done := make(chan struct{})
 	defer close(done)
 
 	start := time.Now()
 
-	rand := func() interface{} { return rand.Intn(50000000) }
+	rand := func() int { return rand.Intn(50000000) }
 
-	randIntStream := toInt(done, repeatFn(done, rand))
+	randIntStream := pipeline.RepeatFn(done, rand)
 
 	numFinders := runtime.NumCPU()
 	fmt.Printf("Spinning up %d prime finders.\n", numFinders)
-	finders := make([]<-chan interface{}, numFinders)
+	finders := make([]<-chan int, numFinders)
 	fmt.Println("Primes:")
 	for i := 0; i < numFinders; i++ {
 		finders[i] = primeFinder(done, randIntStream)
 	}
 
-	for prime := range take(done, fanIn(done, finders...), 10) {
+	for prime := range pipeline.Take(done, pipeline.FanIn(done, finders...), 10) {
 		fmt.Printf("\t%d\n", prime)
 	}
 
 	fmt.Printf("Search took: %v", time.Since(start))
 }
 
+// fanInFanOutOrderedExample
+// fanIn 不保证结果的顺序，pipeline.OrderedFanOut 为每个值分配序号，
+// 在多个 worker 中并发处理后，按照输入的顺序重新组装结果。
+// 本例按顺序检查 [2, 50) 中的每个数是否为素数。
+func fanInFanOutOrderedExample() []int {
+	type candidate struct {
+		integer int
+		prime   bool
+	}
+	isPrime := func(integer int) candidate {
+		for divisor := integer - 1; divisor > 1; divisor-- {
+			if integer%divisor == 0 {
+				return candidate{integer: integer}
+			}
+		}
+		return candidate{integer: integer, prime: true}
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	integers := make([]int, 0, 48)
+	for i := 2; i < 50; i++ {
+		integers = append(integers, i)
+	}
+
+	numFinders := runtime.NumCPU()
+	var primes []int
+	for c := range pipeline.OrderedFanOut(done, pipeline.Generator(done, integers...), numFinders, 2*numFinders, isPrime) {
+		if c.prime {
+			primes = append(primes, c.integer)
+		}
+	}
+	fmt.Printf("Primes: %v\n", primes)
+	return primes
+}
+
+// fanInFanOutElasticExample
+// fanInFanOutExmaple 中 primeFinder 的数量在整个运行过程中固定为 runtime.NumCPU()，
+// pipeline.NewElastic 根据输入队列的积压和每个值的处理耗时动态调整 worker 的数量，
+// 输入突发时扩容，空闲时缩容。
+func fanInFanOutElasticExample() {
+	isPrime := func(integer int) int {
+		for divisor := integer - 1; divisor > 1; divisor-- {
+			if integer%divisor == 0 {
+				return 0
+			}
+		}
+		return integer
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	rand := func() int { return rand.Intn(1000000) }
+	cfg := pipeline.ElasticConfig{MinWorkers: 1, MaxWorkers: runtime.NumCPU()}
+	finders := pipeline.NewElastic(done, pipeline.Take(done, pipeline.RepeatFn(done, rand), 200), cfg, isPrime)
+
+	var count int
+	for prime := range finders.Out() {
+		if prime == 0 {
+			continue
+		}
+		count++
+		fmt.Printf("\t%d (workers: %d)\n", prime, finders.Workers())
+	}
+	fmt.Printf("Found %d primes.\n", count)
+}
+
 /*
 	or-done-channel
 */
+// 使用 pipeline.OrDone 来封装多层嵌套的循环
 func orDoneExample() {
-	orDone := func(done, c <-chan interface{}) <-chan interface{} {
-		// 使用 orDone 来封装多层嵌套的循环
-		valStream := make(chan interface{})
-		go func() {
-			defer close(valStream)
-			for {
-				select {
-				case <-done:
-					return
-				case v, ok := <-c:
-					if ok == false {
-						return
-					}
-					select {
-					case valStream <- v:
-					case <-done:
-					}
-				}
-			}
-		}()
-		return valStream
-	}
-
-	var done chan interface{}
+	var done chan struct{}
 	var myChan chan interface{}
 	// ...
 	// ...
 
-	for val := range orDone(done, myChan) {
+	for val := range pipeline.OrDone(done, myChan) {
 		fmt.Println(val)
 	}
 
@@ -917,94 +737,52 @@ func orDoneExample() {
 /*
 	tee-channel
 */
-func teeChanExample() {
-
-	orDone := func(done, c <-chan interface{}) <-chan interface{} {
-		valStream := make(chan interface{})
-		go func() {
-			defer close(valStream)
-			for {
-				select {
-				case <-done:
-					return
-				case v, ok := <-c:
-					if ok == false {
-						return
-					}
-					select {
-					case valStream <- v:
-					case <-done:
-					}
-				}
-			}
-		}()
-		return valStream
-	}
+func teeChanExample() [][2]int {
+	done := make(chan struct{}) // done chan
+	defer close(done)
+	out1, out2 := pipeline.Tee(done, pipeline.Take(done, pipeline.Repeat(done, 1, 2), 4))
 
-	take := func( // 只会从其传入的 valueStream 中取出第一个 num 项目
-		done <-chan interface{},
-		valueStream <-chan interface{},
-		num int) <-chan interface{} {
-		takeStream := make(chan interface{})
-		go func() {
-			defer close(takeStream)
-			for i := 0; i < num; i++ {
-				select {
-				case <-done:
-					return
-				case takeStream <- valueStream:
-				}
-			}
-		}()
-		return takeStream
+	var pairs [][2]int
+	for val1 := range out1 {
+		val2 := <-out2
+		fmt.Printf("out1: %v, out2: %v\n", val1, val2)
+		pairs = append(pairs, [2]int{val1, val2})
 	}
+	return pairs
+}
 
-	tee := func(done <-chan interface{}, in <-chan interface{}) (_, _ <-chan interface{}) {
+// broadcastExample
+// tee 只能分成两路，并且一个读取慢的消费者会拖慢另一个。
+// pipeline.NewBroadcast 将一个流分发给 N 个订阅者，每个订阅者都有自己的缓冲区，
+// 订阅者跟不上时可以选择等待（BlockAll）、丢弃（DropLagging）或者断开（DisconnectLagging）。
+// 本例将同一个流同时发送给指标、日志和存储，其中存储的写入很慢。
+func broadcastExample() {
+	done := make(chan struct{})
+	defer close(done)
 
-		out1 := make(chan interface{})
-		out2 := make(chan interface{})
-		go func() {
-			defer close(out2)
-			defer close(out1)
-			for val := range orDone(done, in) {
-				var out1, out2 = out1, out2
-				for i := 0; i < 2; i++ {
-					select {
-					case <-done:
-					case out1 <- val:
-						out1 = nil
-					case out2 <- val:
-						out2 = nil
-					}
-				}
-			}
-		}()
-		return out1, out2
-	}
+	events := pipeline.Take(done, pipeline.RepeatFn(done, rand.Int), 50)
+	b := pipeline.NewBroadcast(done, events, 3, 5, pipeline.DropLagging)
+	outs := b.Outs()
 
-	repeat := func(done <-chan interface{}, values ...interface{}) <-chan interface{} {
-		valueStream := make(chan interface{})
-		go func() {
-			defer close(valueStream)
-			for {
-				for _, v := range values {
-					select {
-					case <-done:
-						return
-					case valueStream <- v:
-					}
-				}
-			}
-		}()
-		return valueStream
+	var wg sync.WaitGroup
+	consume := func(name string, in <-chan int, delay time.Duration) {
+		defer wg.Done()
+		var count int
+		for range in {
+			time.Sleep(delay)
+			count++
+		}
+		fmt.Printf("%-8s received %d events\n", name, count)
 	}
 
-	done := make(chan interface{}) // done chan
-	defer close(done)
-	out1, out2 := tee(done, take(done, repeat(done, 1, 2), 4))
+	wg.Add(3)
+	go consume("metrics", outs[0], 0)
+	go consume("logs", outs[1], 0)
+	go consume("storage", outs[2], time.Millisecond) // 慢速的订阅者
+	wg.Wait()
 
-	for val1 := range out1 {
-		fmt.Printf("out1: %v, out2: %v\n", val1, <-out2)
+	for i, s := range b.Stats() {
+		fmt.Printf("subscriber %d: %+v\n", i, s)
 	}
 }
 
@@ -1012,80 +790,203 @@ func teeChanExample() {
 	bridge Channel
 */
 func bridgeChannelExample() {
-	orDone := func(done, c <-chan interface{}) <-chan interface{} {
-		valStream := make(chan interface{})
+	genVals := func() <-chan (<-chan int) {
+		chanStream := make(chan (<-chan int))
+
 		go func() {
-			defer close(valStream)
-			for {
-				select {
-				case <-done:
-					return
-				case v, ok := <-c:
-					if ok == false {
-						return
-					}
-					select {
-					case valStream <- v:
-					case <-done:
-					}
-				}
+			defer close(chanStream)
+			for i := 0; i < 10; i++ {
+				stream := make(chan int, 1)
+				stream <- i
+				chanStream <- stream
+				close(stream)
 			}
 		}()
-		return valStream
+		return chanStream
 	}
 
-	bridge := func(done <-chan interface{}, chanStream <-chan <-chan interface{}) <-chan interface{} {
-		valStream := make(chan interface{})
-		go func() {
-			defer close(valStream)
-			for {
-				var stream <-chan interface{}
-				select {
-				case maybeStream, ok := <-chanStream:
-					if ok == false {
-						return
-					}
-					stream = maybeStream
-				case <-done:
-					return
-				}
-
-				for val := range orDone(done, stream) {
-					select {
-					case valStream <- val:
-					case <-done:
-					}
-				}
-			}
-		}()
-		return valStream
+	for v := range pipeline.Bridge(nil, genVals()) {
+		fmt.Printf("%v ", v)
 	}
 
-	genVals := func() <-chan <-chan interface{} {
-		chanStream := make(chan (<-chan interface{}))
+}
+
+// bridgeChannelExample2
+// bridge 无法告诉消费者值来自哪一个内部 stream，也会忽略内部 stream 的错误。
+// pipeline.BridgeWith 为每个值标注来源 stream 的下标，
+// 并将内部 stream 的错误包装为 *pipeline.StreamError 通过单独的错误 channel 返回。
+func bridgeChannelExample2() {
+	done := make(chan struct{})
+	defer close(done)
 
+	genVals := func() <-chan (<-chan pipeline.Result[int]) {
+		chanStream := make(chan (<-chan pipeline.Result[int]))
 		go func() {
 			defer close(chanStream)
-			for i := 0; i < 10; i++ {
-				stream := make(chan interface{}, 1)
-				stream <- i
-				chanStream <- stream
+			for i := 0; i < 5; i++ {
+				stream := make(chan pipeline.Result[int], 2)
+				stream <- pipeline.Result[int]{Value: i}
+				if i%2 == 1 { // 奇数下标的 stream 产生一个错误
+					stream <- pipeline.Result[int]{Err: fmt.Errorf("odd stream %d failed", i)}
+				}
 				close(stream)
+				chanStream <- stream
 			}
 		}()
 		return chanStream
 	}
 
-	for v := range bridge(nil, genVals()) {
-		fmt.Printf("%v ", v)
+	vals, errs := pipeline.BridgeWith(done, genVals(), pipeline.BridgeOptions{})
+	for vals != nil || errs != nil { // 同时读取值和错误
+		select {
+		case v, ok := <-vals:
+			if !ok {
+				vals = nil
+				continue
+			}
+			fmt.Printf("stream %d: %v\n", v.Stream, v.Value)
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			fmt.Printf("error: %v\n", err)
+		}
 	}
-
 }
 
 /*
-	Queuing - 队列排队(TODO)
+	Queuing - 队列排队
 */
+// 队列是在 pipeline 的 stage 之间插入的缓冲区，即使下游 stage 还没有准备好，
+// 上游 stage 也可以继续工作。
+// 引入队列几乎不会缩短 pipeline 的总运行时间，它只是改变了 stage 处于阻塞状态的时间。
+// 队列应该在以下情况使用：
+// 1. 如果在一个 stage 中批处理请求可以节省时间
+// 2. 如果 stage 中的延迟会产生反馈回路（例如重试）
+//
+// 利特尔法则(Little's Law)： L = λW
+// L 是系统中平均的单元数，λ 是单元的平均到达率，W 是单元在系统中花费的平均时间。
+// 在稳定的系统中，增加队列的长度 L 只会增加 W，而不会提高吞吐量 λ。
+// 所以队列的长度应该根据 λ 和可以接受的 W 来计算，而不是随意猜测 channel 的缓冲大小。
+
+// queuingExample
+// 快速的生产者和慢速的消费者之间插入一个容量为 5 的队列，
+// 对比不同的溢出策略下的计数器。
+func queuingExample() {
+	const capacity = 5
+	policies := []struct {
+		name   string
+		policy pipeline.OverflowPolicy
+	}{
+		{"Block", pipeline.Block},
+		{"DropNewest", pipeline.DropNewest},
+		{"DropOldest", pipeline.DropOldest},
+		{"FailOnFull", pipeline.FailOnFull},
+	}
+
+	for _, p := range policies {
+		done := make(chan struct{})
+		q := pipeline.NewQueue(done, pipeline.Take(done, pipeline.RepeatFn(done, rand.Int), 20), capacity, p.policy)
+
+		start := time.Now()
+		var received int
+		for range q.Out() {
+			time.Sleep(time.Millisecond) // 慢速的消费者
+			received++
+		}
+		elapsed := time.Since(start)
+		close(done)
+
+		s := q.Stats()
+		// λ：单位时间内被消费的值的个数，根据 L = λW 估算值在队列中的平均等待时间
+		throughput := float64(s.Dequeued) / elapsed.Seconds()
+		fmt.Printf("%-10s received=%-2d enqueued=%-2d dropped=%-2d highWater=%d err=%v W≈%v\n",
+			p.name, received, s.Enqueued, s.Dropped, s.HighWater, q.Err(),
+			time.Duration(float64(capacity)/throughput*float64(time.Second)).Round(time.Microsecond))
+	}
+}
 
 /*
-	Context (TODO)
+	Context
 */
+// done channel 只能表达"取消"，context.Context 在此基础上还可以携带截止时间、
+// 取消的原因以及请求范围内的值。将 done 替换为 ctx 之后，
+// 每个 stage 通过 ctx.Done() 来退出，消费者在 channel 关闭后通过 pipeline.Err
+// 或者 pipeline.Collect 得知 pipeline 是正常结束还是被取消。
+// pipeline 包中的 stage 都有接收 ctx 的版本，这里只保留书中特有的 stage。
+// 一个 HTTP 请求被放弃时，r.Context() 会被取消，整条 pipeline 随之停止。
+
+// multiplyCtx 接收 ctx 的 multiply
+func multiplyCtx(ctx context.Context, intStream <-chan int, multiplier int) <-chan int {
+	return pipeline.MapCtx(ctx, intStream, func(i int) int { return i * multiplier })
+}
+
+// addCtx 接收 ctx 的 add
+func addCtx(ctx context.Context, intStream <-chan int, additive int) <-chan int {
+	return pipeline.MapCtx(ctx, intStream, func(i int) int { return i + additive })
+}
+
+// primeFinderCtx 接收 ctx 的 primeFinder
+// 判断素数是耗时的计算，所以在计算过程中也要检查 ctx，而不只是在发送时检查。
+func primeFinderCtx(ctx context.Context, intStream <-chan int) <-chan int {
+	primeStream := make(chan int)
+	go func() {
+		defer close(primeStream)
+		for integer := range pipeline.OrDone(ctx.Done(), intStream) {
+			integer -= 1
+			prime := true
+			for divisor := integer - 1; divisor > 1; divisor-- {
+				if divisor%1024 == 0 && ctx.Err() != nil {
+					return
+				}
+				if integer%divisor == 0 {
+					prime = false
+					break
+				}
+			}
+
+			if prime {
+				select {
+				case <-ctx.Done():
+					return
+				case primeStream <- integer:
+				}
+			}
+		}
+	}()
+	return primeStream
+}
+
+// contextExample
+// 使用 ctx 替换 done 之后的 pipelineExample3，
+// 模拟客户端在请求处理过程中断开连接。
+func contextExample() {
+	errClientGone := errors.New("client went away")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	counter := 0
+	intStream := pipeline.RepeatFnCtx(ctx, func() int {
+		counter++
+		if counter == 5 {
+			cancel(errClientGone) // 第 5 个值产生时，客户端断开了连接
+		}
+		return counter
+	})
+
+	values, err := pipeline.Collect(ctx, multiplyCtx(ctx, addCtx(ctx, multiplyCtx(ctx, intStream, 2), 1), 2))
+	fmt.Printf("values: %v\n", values)
+	fmt.Printf("pipeline stopped: %v\n", err)
+}
+
+// contextExample2
+// 带截止时间的 ctx，在规定的时间内尽可能多地寻找素数
+func contextExample2() {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	rand := func() int { return rand.Intn(1000000) }
+	primes, err := pipeline.Collect(ctx, primeFinderCtx(ctx, pipeline.RepeatFnCtx(ctx, rand)))
+	fmt.Printf("found %d primes before deadline: %v\n", len(primes), err)
+}
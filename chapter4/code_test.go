@@ -1,11 +1,23 @@
 package chapter4
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"concurrency_in_go/leaktest"
+	"concurrency_in_go/pipeline"
+)
 
 /*
 go test ./chapter4 -v -count=1 -run TestCodeExample
 */
 func TestCodeExample(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
 	codeExample()
 }
 
@@ -13,6 +25,7 @@ func TestCodeExample(t *testing.T) {
 go test ./chapter4 -v -count=1 -run TestCodeExample2
 */
 func TestCodeExample2(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
 	codeExample2()
 }
 
@@ -20,20 +33,39 @@ func TestCodeExample2(t *testing.T) {
 go test ./chapter4 -v -count=1 -run TestCodeExample3
 */
 func TestCodeExample3(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
 	codeExample3()
 }
 
 /*
 go test ./chapter4 -v -count=1 -run TestGoroutineExample3
 */
+// forSelectExample6 故意泄漏一个 goroutine，测试确认泄漏确实存在
 func TestForSelectExample6(t *testing.T) {
+	before := leaktest.Take()
 	forSelectExample6()
+	if leaks := before.Leaks(100 * time.Millisecond); len(leaks) != 1 {
+		t.Fatalf("got %d leaked goroutines, want the blocked newRandStream", len(leaks))
+	}
+}
+
+/*
+go test ./chapter4 -v -count=1 -run TestGoroutineExample
+*/
+// goroutineExample 同样故意泄漏了 doWork 的 goroutine
+func TestGoroutineExample(t *testing.T) {
+	before := leaktest.Take()
+	goroutineExample()
+	if leaks := before.Leaks(100 * time.Millisecond); len(leaks) != 1 {
+		t.Fatalf("got %d leaked goroutines, want the blocked doWork", len(leaks))
+	}
 }
 
 /*
 go test ./chapter4 -v -count=1 -run TestGoroutineExample4
 */
 func TestForSelectExample7(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
 	forSelectExample7()
 }
 
@@ -41,34 +73,53 @@ func TestForSelectExample7(t *testing.T) {
 go test ./chapter4 -v -count=1 -run TestOrChannelExample
 */
 func TestOrChannelExample(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
 	orChannelExample()
 }
 
+// newStatusServers 返回一个正常的本地服务器的 URL 和一个已经关闭的服务器的 URL，
+// 替代 https://www.baidu.com 和 https://badhost，测试不再需要访问外网。
+func newStatusServers(t *testing.T) (ok, bad string) {
+	okServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(okServer.Close)
+
+	badServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	badServer.Close()
+	return okServer.URL, badServer.URL
+}
+
 /*
 go test ./chapter4 -v -count=1 -run TestErrHandleExample
 */
 func TestErrHandleExample(t *testing.T) {
-	errHandleExample()
+	leaktest.VerifyNoLeaks(t)
+	ok, bad := newStatusServers(t)
+	errHandleExample(ok, bad)
 }
 
 /*
 go test ./chapter4 -v -count=1 -run TestErrHandleExample2
 */
 func TestErrHandleExample2(t *testing.T) {
-	errHandleExample2()
+	leaktest.VerifyNoLeaks(t)
+	ok, bad := newStatusServers(t)
+	errHandleExample2(ok, bad)
 }
 
 /*
 go test ./chapter4 -v -count=1 -run TestErrHandleExample3
 */
 func TestErrHandleExample3(t *testing.T) {
-	errHandleExample3()
+	leaktest.VerifyNoLeaks(t)
+	ok, bad := newStatusServers(t)
+	errHandleExample3("a", ok, "b", bad, "c", "d")
 }
 
 /*
 go test ./chapter4 -v -count=1 -run TestPipelineExample
 */
 func TestPipelineExample(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
 	pipelineExample()
 }
 
@@ -76,6 +127,7 @@ func TestPipelineExample(t *testing.T) {
 go test ./chapter4 -v -count=1 -run TestPipelineExample3
 */
 func TestPipelineExample3(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
 	pipelineExample3()
 }
 
@@ -83,33 +135,187 @@ func TestPipelineExample3(t *testing.T) {
 go test ./chapter4 -v -count=1 -run TestGeneratorExample
 */
 func TestGeneratorExample(t *testing.T) {
-	generatorExample()
+	leaktest.VerifyNoLeaks(t)
+	got := generatorExample()
+	if want := []int{1, 1, 1, 1, 1, 1, 1, 1, 1, 1}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
 }
 
 /*
 go test ./chapter4 -v -count=1 -run TestGeneratorExample2
 */
 func TestGeneratorExample2(t *testing.T) {
-	generatorExample2()
+	leaktest.VerifyNoLeaks(t)
+	if got := generatorExample2(); len(got) != 10 {
+		t.Fatalf("got %d values, want 10", len(got))
+	}
 }
 
 /*
 go test ./chapter4 -v -count=1 -run TestForSelectExample8
 */
 func TestForSelectExample8(t *testing.T) {
-	forSelectExample8()
+	leaktest.VerifyNoLeaks(t)
+	if got, want := forSelectExample8(), "Iam.Iam.I"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+/*
+go test ./chapter4 -v -count=1 -run TestTeeChanExample
+*/
+func TestTeeChanExample(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
+	got := teeChanExample()
+	if want := [][2]int{{1, 1}, {2, 2}, {1, 1}, {2, 2}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
 }
 
 /*
 go test ./chapter4 -v -count=1 -run TestFanInFanOutExample
 */
 func TestFanInFanOutExample(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
 	fanInFanOutExmaple()
 }
 
+/*
+go test ./chapter4 -v -count=1 -run TestFanInFanOutOrderedExample
+*/
+func TestFanInFanOutOrderedExample(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
+	want := []int{2, 3, 5, 7, 11, 13, 17, 19, 23, 29, 31, 37, 41, 43, 47}
+	if got := fanInFanOutOrderedExample(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+/*
+go test ./chapter4 -v -count=1 -run TestFanInFanOutElasticExample
+*/
+func TestFanInFanOutElasticExample(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
+	fanInFanOutElasticExample()
+}
+
+/*
+go test ./chapter4 -v -count=1 -run TestBroadcastExample
+*/
+func TestBroadcastExample(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
+	broadcastExample()
+}
+
 /*
 go test ./chapter4 -v -count=1 -run TestBridgeChannelExample
 */
 func TestBridgeChannelExample(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
 	bridgeChannelExample()
 }
+
+/*
+go test ./chapter4 -v -count=1 -run TestBridgeChannelExample2
+*/
+func TestBridgeChannelExample2(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
+	bridgeChannelExample2()
+}
+
+/*
+go test ./chapter4 -v -count=1 -run TestContextExample
+*/
+func TestContextExample(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
+	contextExample()
+	contextExample2()
+}
+
+/*
+go test ./chapter4 -v -count=1 -run TestContextPipeline
+*/
+func TestContextPipeline(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	values, err := pipeline.Collect(ctx, multiplyCtx(ctx, addCtx(ctx, multiplyCtx(ctx, pipeline.GeneratorCtx(ctx, 1, 2, 3, 4), 2), 1), 2))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []int{6, 10, 14, 18}; !reflect.DeepEqual(values, want) {
+		t.Fatalf("got %v, want %v", values, want)
+	}
+}
+
+/*
+go test ./chapter4 -v -count=1 -run TestContextCancelCause
+*/
+func TestContextCancelCause(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
+	errClientGone := errors.New("client went away")
+	ctx, cancel := context.WithCancelCause(context.Background())
+
+	stream := addCtx(ctx, pipeline.RepeatFnCtx(ctx, func() int { return 1 }), 1)
+	<-stream
+	cancel(errClientGone)
+
+	if _, err := pipeline.Collect(ctx, stream); !errors.Is(err, errClientGone) {
+		t.Fatalf("got %v, want %v", err, errClientGone)
+	}
+}
+
+/*
+go test ./chapter4 -v -count=1 -run TestContextDeadline
+*/
+func TestContextDeadline(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// 每个数都很大，primeFinderCtx 必须在计算过程中响应截止时间
+	big := func() int { return 1<<40 + 1 }
+	start := time.Now()
+	_, err := pipeline.Collect(ctx, primeFinderCtx(ctx, pipeline.RepeatFnCtx(ctx, big)))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("primeFinderCtx ignored the deadline, took %v", elapsed)
+	}
+}
+
+/*
+go test ./chapter4 -v -count=1 -run TestBridgeCtx
+*/
+func TestBridgeCtx(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	chanStream := make(chan (<-chan int))
+	go func() {
+		defer close(chanStream)
+		for i := 0; i < 3; i++ {
+			chanStream <- pipeline.GeneratorCtx(ctx, i, i)
+		}
+	}()
+
+	values, err := pipeline.Collect(ctx, pipeline.BridgeCtx(ctx, chanStream))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []int{0, 0, 1, 1, 2, 2}; !reflect.DeepEqual(values, want) {
+		t.Fatalf("got %v, want %v", values, want)
+	}
+}
+
+/*
+go test ./chapter4 -v -count=1 -run TestQueuingExample
+*/
+func TestQueuingExample(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
+	queuingExample()
+}
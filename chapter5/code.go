@@ -0,0 +1,311 @@
+// Package chapter5 大规模并发
+// 第五章主要讲解在大规模的系统中如何组合并发模式：
+// 错误传递、超时和取消、心跳、复制请求、速率限制以及治愈异常的 goroutine
+
+package chapter5
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"concurrency_in_go/pipeline"
+	"concurrency_in_go/ratelimit"
+)
+
+/*
+	心跳
+*/
+// 心跳是并发进程向外界发出信号的一种方式，表示它还活着。
+// 有两种类型的心跳：
+// 1. 在一段时间间隔内发出的心跳
+// 2. 在工作单元开始时发出的心跳
+// 对于并发代码的测试，心跳可以代替 time.Sleep：
+// 只要 goroutine 还在发出心跳，测试就知道它没有卡住，可以继续等待。
+
+// doWork 每隔 pulseInterval 发出一次心跳，每隔 2*pulseInterval 发送一次结果
+// 心跳和结果通过不同的 channel 返回。
+func doWork(done <-chan struct{}, pulseInterval time.Duration) (<-chan struct{}, <-chan time.Time) {
+	heartbeat := make(chan struct{}) // 心跳的 channel
+	results := make(chan time.Time)
+	go func() {
+		defer close(heartbeat)
+		defer close(results)
+
+		pulseTicker := time.NewTicker(pulseInterval) // 以 pulseInterval 为间隔发出心跳
+		defer pulseTicker.Stop()
+		workTicker := time.NewTicker(2 * pulseInterval) // 模拟工作的到来
+		defer workTicker.Stop()
+		pulse, workGen := pulseTicker.C, workTicker.C
+
+		sendPulse := func() {
+			select {
+			case heartbeat <- struct{}{}:
+			default: // 可能没有人在监听心跳
+			}
+		}
+		sendResult := func(r time.Time) {
+			for {
+				select {
+				case <-done:
+					return
+				case <-pulse: // 发送结果时也需要发出心跳
+					sendPulse()
+				case results <- r:
+					return
+				}
+			}
+		}
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-pulse:
+				sendPulse()
+			case r := <-workGen:
+				sendResult(r)
+			}
+		}
+	}()
+	return heartbeat, results
+}
+
+// heartbeatExample
+// 监听 doWork 的心跳和结果，2*pulseInterval 内没有任何信号则认为 goroutine 不健康
+func heartbeatExample() {
+	done := make(chan struct{})
+	time.AfterFunc(100*time.Millisecond, func() { close(done) })
+
+	const timeout = 20 * time.Millisecond
+	heartbeat, results := doWork(done, timeout/2)
+	for {
+		select {
+		case _, ok := <-heartbeat:
+			if !ok {
+				return
+			}
+			fmt.Println("pulse")
+		case r, ok := <-results:
+			if !ok {
+				return
+			}
+			fmt.Printf("results %v\n", r.Second())
+		case <-time.After(timeout):
+			fmt.Println("worker goroutine is not healthy!")
+			return
+		}
+	}
+}
+
+// doWorkPerUnit 在每个工作单元开始时发出心跳
+// 心跳 channel 带有一个缓冲区，保证即使没有人及时读取，至少也有一个心跳被发出。
+func doWorkPerUnit(done <-chan struct{}, nums ...int) (<-chan struct{}, <-chan int) {
+	return pipeline.WithHeartbeat(done, pipeline.Generator(done, nums...), 0, func(n int) int {
+		return n
+	})
+}
+
+// primeFinder 检查 intStream 中的每个数是否为素数
+// 每个数开始检查之前都会发出心跳，因为结果中只包含素数，
+// 消费者可能很长时间收不到结果，但心跳说明 primeFinder 仍然在工作。
+func primeFinder(done <-chan struct{}, intStream <-chan int, pulseInterval time.Duration) (<-chan struct{}, <-chan int) {
+	isPrime := func(integer int) int {
+		for divisor := integer - 1; divisor > 1; divisor-- {
+			if integer%divisor == 0 {
+				return 0
+			}
+		}
+		return integer
+	}
+
+	heartbeat, candidates := pipeline.WithHeartbeat(done, intStream, pulseInterval, isPrime)
+	primes := make(chan int)
+	go func() {
+		defer close(primes)
+		for prime := range pipeline.OrDone(done, candidates) {
+			if prime == 0 { // 不是素数
+				continue
+			}
+			select {
+			case <-done:
+				return
+			case primes <- prime:
+			}
+		}
+	}()
+	return heartbeat, primes
+}
+
+/*
+	复制请求
+*/
+// 对于某些应用来说，尽可能快地得到响应是最重要的。
+// 可以将请求复制到多个处理程序（goroutine、进程或者服务器），使用最先返回的结果，并取消其余的请求。
+// 代价是需要消耗更多的资源，所以复制请求只适用于处理程序之间的响应时间差别较大的情况。
+
+// replicatedRequestsExample 将同一个请求发送给 len(latencies) 个处理程序，
+// 第 i 个处理程序需要 latencies[i] 才能完成，返回最先完成的处理程序的下标。
+func replicatedRequestsExample(latencies ...time.Duration) int {
+	done := make(chan struct{})
+	defer close(done)
+
+	replicas := make([]pipeline.Replica[int], len(latencies))
+	for i, latency := range latencies {
+		id, latency := i, latency
+		replicas[i] = func(done <-chan struct{}) (int, error) {
+			select {
+			case <-done: // 其他处理程序已经返回了结果
+				return 0, fmt.Errorf("handler %d canceled", id)
+			case <-time.After(latency): // 模拟负载
+			}
+			return id, nil
+		}
+	}
+
+	winner, id, err := pipeline.FirstOf(done, pipeline.HedgeOptions{}, replicas...)
+	if err != nil {
+		fmt.Println(err)
+		return -1
+	}
+	fmt.Printf("received result from #%v, took %v\n", id, latencies[winner])
+	return winner
+}
+
+/*
+	速率限制
+*/
+// 速率限制约束某种资源在一段时间内被访问的次数，防止系统被过多的请求压垮，
+// 也可以防止一个用户占用其他用户的资源。
+// 大多数速率限制使用令牌桶算法：桶的深度 d 表示最多可以同时访问 d 次，
+// 每次访问消耗一个令牌，令牌以速率 r 补充，桶空的时候需要等待新的令牌。
+// 将多个令牌桶组合起来，可以同时限制每秒和每分钟的请求数，
+// 还可以为磁盘和网络等不同的资源设置各自的限制。
+
+// apiConnection 受到速率限制的 API 连接
+// 所有请求共享 apiLimit，读文件还要受到 diskLimit 的限制，解析地址还要受到 networkLimit 的限制。
+type apiConnection struct {
+	apiLimit     ratelimit.Limiter
+	diskLimit    ratelimit.Limiter
+	networkLimit ratelimit.Limiter
+}
+
+// openAPIConnection 使用书中的速率：
+// API 每秒 2 次、每分钟 10 次，磁盘每秒 1 次，网络每秒 3 次
+func openAPIConnection() *apiConnection {
+	return &apiConnection{
+		apiLimit: ratelimit.Multi(
+			ratelimit.NewTokenBucket(ratelimit.Per(2, time.Second), 2),
+			ratelimit.NewTokenBucket(ratelimit.Per(10, time.Minute), 10),
+		),
+		diskLimit: ratelimit.Multi(
+			ratelimit.NewTokenBucket(ratelimit.Limit(1), 1),
+		),
+		networkLimit: ratelimit.Multi(
+			ratelimit.NewTokenBucket(ratelimit.Per(3, time.Second), 3),
+		),
+	}
+}
+
+func (a *apiConnection) ReadFile(ctx context.Context) error {
+	if err := ratelimit.Multi(a.apiLimit, a.diskLimit).Wait(ctx); err != nil {
+		return err
+	}
+	// 假装在这里读文件
+	return nil
+}
+
+func (a *apiConnection) ResolveAddress(ctx context.Context) error {
+	if err := ratelimit.Multi(a.apiLimit, a.networkLimit).Wait(ctx); err != nil {
+		return err
+	}
+	// 假装在这里解析地址
+	return nil
+}
+
+// rateLimitExample 同时发出 n 个读文件请求和 n 个解析地址请求，返回所有请求完成花费的时间
+func rateLimitExample(conn *apiConnection, n int) time.Duration {
+	start := time.Now()
+	var wg sync.WaitGroup
+	wg.Add(2 * n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			if err := conn.ReadFile(context.Background()); err != nil {
+				log.Printf("cannot ReadFile: %v", err)
+			}
+			log.Printf("ReadFile")
+		}()
+		go func() {
+			defer wg.Done()
+			if err := conn.ResolveAddress(context.Background()); err != nil {
+				log.Printf("cannot ResolveAddress: %v", err)
+			}
+			log.Printf("ResolveAddress")
+		}()
+	}
+	wg.Wait()
+	log.Printf("Done.")
+	return time.Since(start)
+}
+
+/*
+	治愈异常的 goroutine
+*/
+// 长时间运行的 goroutine 可能会卡住或者 panic，并且自己无法恢复。
+// 管理员（steward）负责监控病区（ward）的心跳，ward 不健康时停止它并启动一个新的 ward。
+// steward 依次转发每个 ward 的输出，消费者看到的是一个连续的流。
+
+// stewardExample ward 依次发送 values 中的值，并且在前几次启动时模拟不同的故障：
+// 第 1 次启动时返回错误，第 2 次启动时 panic，第 3 次启动时卡住不再发出心跳。
+// steward 重启 ward 之后从下一个还没有发送的值继续，返回消费者收到的值和每次重启的原因。
+func stewardExample(values ...int) ([]int, []error) {
+	done := make(chan struct{})
+	defer close(done)
+
+	// 卡住的 ward 直到 steward 关闭 wardDone 才会返回，可能和新启动的 ward 同时运行，
+	// 所以 ward 之间共享的状态需要使用原子操作
+	var next, starts int64
+	ward := func(wardDone <-chan struct{}, pulse func(), out chan<- int) error {
+		start := atomic.AddInt64(&starts, 1)
+		for i := atomic.LoadInt64(&next); i < int64(len(values)); i = atomic.AddInt64(&next, 1) {
+			pulse()
+			switch {
+			case start == 1 && i == 1:
+				return fmt.Errorf("ward failed before %d", values[i])
+			case start == 2 && i == 2:
+				panic("ward crashed")
+			case start == 3 && i == 4:
+				<-wardDone // 卡住，直到 steward 放弃这个 ward
+				return nil
+			}
+			select {
+			case <-wardDone:
+				return nil
+			case out <- values[i]:
+			}
+		}
+		return nil
+	}
+
+	var reasons []error
+	cfg := pipeline.StewardConfig{
+		Timeout: 20 * time.Millisecond,
+		Backoff: time.Millisecond,
+		OnRestart: func(restart int, reason error) {
+			fmt.Printf("restart %d: %v\n", restart, reason)
+			reasons = append(reasons, reason)
+		},
+	}
+	s := pipeline.NewSteward(done, cfg, ward)
+
+	var received []int
+	for v := range s.Out() {
+		fmt.Println(v)
+		received = append(received, v)
+	}
+	return received, reasons
+}
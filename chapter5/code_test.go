@@ -0,0 +1,128 @@
+package chapter5
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"concurrency_in_go/leaktest"
+	"concurrency_in_go/pipeline"
+	"concurrency_in_go/pipelinetest"
+	"concurrency_in_go/ratelimit"
+)
+
+/*
+go test ./chapter5 -v -count=1 -run TestHeartbeatExample
+*/
+func TestHeartbeatExample(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
+	heartbeatExample()
+}
+
+/*
+go test ./chapter5 -v -count=1 -run TestDoWork
+*/
+// TestDoWork 只要心跳没有停止就继续等待结果
+func TestDoWork(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
+	done := make(chan struct{})
+	defer close(done)
+
+	const pulseInterval = 5 * time.Millisecond
+	heartbeat, results := doWork(done, pulseInterval)
+	pipelinetest.AwaitBeat(t, heartbeat, 20*pulseInterval)
+	pipelinetest.Receive(t, heartbeat, results, 3, 20*pulseInterval)
+}
+
+/*
+go test ./chapter5 -v -count=1 -run TestDoWorkPerUnit
+*/
+// TestDoWorkPerUnit 先等待第一个心跳，确认 goroutine 已经开始处理，
+// 之后再读取结果，不需要 time.Sleep 或者猜测一个足够长的超时时间。
+func TestDoWorkPerUnit(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
+	done := make(chan struct{})
+	defer close(done)
+
+	intSlice := []int{0, 1, 2, 3, 5}
+	heartbeat, results := doWorkPerUnit(done, intSlice...)
+	pipelinetest.AwaitBeat(t, heartbeat, time.Second)
+
+	if got := pipelinetest.Receive(t, heartbeat, results, len(intSlice), time.Second); !reflect.DeepEqual(got, intSlice) {
+		t.Fatalf("got %v, want %v", got, intSlice)
+	}
+}
+
+/*
+go test ./chapter5 -v -count=1 -run TestPrimeFinder
+*/
+// TestPrimeFinder 每个数的检查都可能很慢，结果之间可能间隔很久，
+// 但只要 primeFinder 还在为每个数发出心跳，测试就不会超时。
+func TestPrimeFinder(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
+	done := make(chan struct{})
+	defer close(done)
+
+	integers := pipeline.Generator(done, 4, 6, 8, 9, 10, 1000003, 12, 14, 1000033, 15, 16, 1000037)
+	heartbeat, primes := primeFinder(done, integers, 10*time.Millisecond)
+
+	got := pipelinetest.Receive(t, heartbeat, primes, 3, 500*time.Millisecond)
+	if want := []int{1000003, 1000033, 1000037}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+/*
+go test ./chapter5 -v -count=1 -run TestStewardExample
+*/
+func TestStewardExample(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
+	values := []int{1, 2, 3, 4, 5, 6}
+	received, reasons := stewardExample(values...)
+	if !reflect.DeepEqual(received, values) {
+		t.Fatalf("got %v, want %v", received, values)
+	}
+	if len(reasons) != 3 {
+		t.Fatalf("got %d restarts, want 3: %v", len(reasons), reasons)
+	}
+	var panicErr *pipeline.PanicError
+	if !errors.As(reasons[1], &panicErr) {
+		t.Errorf("second restart reason %v, want a panic", reasons[1])
+	}
+	if !errors.Is(reasons[2], pipeline.ErrMissedHeartbeat) {
+		t.Errorf("third restart reason %v, want ErrMissedHeartbeat", reasons[2])
+	}
+}
+
+/*
+go test ./chapter5 -v -count=1 -run TestReplicatedRequestsExample
+*/
+func TestReplicatedRequestsExample(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
+	latencies := []time.Duration{time.Second, 500 * time.Millisecond, 10 * time.Millisecond, time.Second}
+	if winner := replicatedRequestsExample(latencies...); winner != 2 {
+		t.Fatalf("got winner %d, want 2", winner)
+	}
+}
+
+/*
+go test ./chapter5 -v -count=1 -run TestRateLimitExample
+*/
+// TestRateLimitExample 使用比书中快 100 倍的速率，API 每 10ms 2 次、每 600ms 10 次
+// 5 个读文件和 5 个解析地址一共 10 个 API 请求，正好用完每 600ms 的 10 次；
+// 磁盘每 10ms 1 次，5 个读文件请求理论上至少需要 40ms，留出 5ms 的计时误差。
+func TestRateLimitExample(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
+	conn := &apiConnection{
+		apiLimit: ratelimit.Multi(
+			ratelimit.NewTokenBucket(ratelimit.Per(2, 10*time.Millisecond), 2),
+			ratelimit.NewTokenBucket(ratelimit.Per(10, 600*time.Millisecond), 10),
+		),
+		diskLimit:    ratelimit.NewTokenBucket(ratelimit.Every(10*time.Millisecond), 1),
+		networkLimit: ratelimit.NewTokenBucket(ratelimit.Per(3, 10*time.Millisecond), 3),
+	}
+	if elapsed := rateLimitExample(conn, 5); elapsed < 35*time.Millisecond || elapsed > 500*time.Millisecond {
+		t.Fatalf("5 ReadFile and 5 ResolveAddress requests took %v, want between 35ms and 500ms", elapsed)
+	}
+}
@@ -0,0 +1,100 @@
+// Package chapter6 goroutine 和 Go 语言运行时
+// 第六章主要讲解 Go 语言运行时如何使用工作窃取算法调度 goroutine
+package chapter6
+
+import (
+	"runtime"
+	"sync"
+
+	"concurrency_in_go/forkjoin"
+	"concurrency_in_go/pipeline"
+)
+
+/*
+	工作窃取
+*/
+// 最简单的调度方式是公平调度：将所有任务平均分配给所有处理器。
+// 但是 fork-join 模型中的任务之间有依赖关系，执行时间也各不相同，
+// 平均分配会导致一部分处理器空闲，另一部分处理器忙不过来。
+// 使用一个所有处理器共享的 FIFO 队列可以解决负载不均衡的问题，
+// 但是所有处理器都要竞争同一个队列，而且任务经常被转移到其他处理器上执行，缓存的局部性很差。
+//
+// 工作窃取算法为每个处理器准备一个双端队列：
+// 1. fork 时，将任务添加到当前线程的队列的尾部
+// 2. 线程空闲时，从随机选择的另一个线程的队列的头部窃取任务
+// 3. join 时，如果还没有完成，从自己的队列的尾部弹出任务执行
+// 4. 自己的队列为空时，等待 join 或者窃取其他队列头部的任务
+// 队列尾部的任务是最近添加的，最有可能在处理器的缓存中，
+// 队列头部的任务是最早添加的，在 fork-join 中通常也是最大的任务，值得被窃取。
+//
+// Go 语言的调度器窃取的是 continuation（go 语句之后的代码），而不是 goroutine 本身，
+// forkjoin 包为了简单窃取的是任务本身，两种方式的区别在于 join 时的等待。
+
+// fib 顺序计算斐波那契数，作为其他实现的基准
+func fib(n int) int {
+	if n < 2 {
+		return n
+	}
+	return fib(n-1) + fib(n-2)
+}
+
+// fibForkJoin 每次递归都 fork 一个任务，由 forkjoin 的 worker 通过工作窃取分担
+func fibForkJoin(p *forkjoin.Pool, n int) int {
+	var fibTask func(w *forkjoin.Worker, n int) int
+	fibTask = func(w *forkjoin.Worker, n int) int {
+		if n < 2 {
+			return n
+		}
+		t := forkjoin.Fork(w, func(w *forkjoin.Worker) int { return fibTask(w, n-1) })
+		return fibTask(w, n-2) + t.Join(w)
+	}
+	return forkjoin.Run(p, func(w *forkjoin.Worker) int { return fibTask(w, n) })
+}
+
+// fibGoroutines 每次递归都启动一个新的 goroutine，交给 Go 语言运行时调度
+func fibGoroutines(n int) int {
+	if n < 2 {
+		return n
+	}
+	var wg sync.WaitGroup
+	var x int
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		x = fibGoroutines(n - 1)
+	}()
+	y := fibGoroutines(n - 2)
+	wg.Wait()
+	return x + y
+}
+
+// fibFanIn 第四章的扇出扇入：先将问题展开为 depth 层的子问题，
+// 再由 runtime.NumCPU() 个 goroutine 顺序计算这些子问题，最后扇入并求和。
+// 子问题的大小在展开时就确定了，大小不一的子问题会导致一部分 goroutine 提前空闲。
+func fibFanIn(n, depth int) int {
+	var subproblems []int
+	var expand func(n, depth int)
+	expand = func(n, depth int) {
+		if n < 2 || depth == 0 {
+			subproblems = append(subproblems, n)
+			return
+		}
+		expand(n-1, depth-1)
+		expand(n-2, depth-1)
+	}
+	expand(n, depth)
+
+	done := make(chan struct{})
+	defer close(done)
+	stream := pipeline.Generator(done, subproblems...)
+	workers := make([]<-chan int, runtime.NumCPU())
+	for i := range workers {
+		workers[i] = pipeline.Map(done, stream, fib)
+	}
+
+	sum := 0
+	for v := range pipeline.FanIn(done, workers...) {
+		sum += v
+	}
+	return sum
+}
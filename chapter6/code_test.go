@@ -0,0 +1,63 @@
+package chapter6
+
+import (
+	"testing"
+
+	"concurrency_in_go/forkjoin"
+	"concurrency_in_go/leaktest"
+)
+
+/*
+go test ./chapter6 -v -count=1 -run TestFib
+*/
+func TestFib(t *testing.T) {
+	leaktest.VerifyNoLeaks(t)
+	p := forkjoin.NewPool(0)
+	defer p.Close()
+
+	for _, n := range []int{0, 1, 2, 10, 20} {
+		want := fib(n)
+		if got := fibForkJoin(p, n); got != want {
+			t.Errorf("fibForkJoin(%d) = %d, want %d", n, got, want)
+		}
+		if got := fibGoroutines(n); got != want {
+			t.Errorf("fibGoroutines(%d) = %d, want %d", n, got, want)
+		}
+		if got := fibFanIn(n, 5); got != want {
+			t.Errorf("fibFanIn(%d) = %d, want %d", n, got, want)
+		}
+	}
+}
+
+/*
+go test ./chapter6 -bench=BenchmarkFib -benchmem -run=^$
+*/
+// BenchmarkFib 比较工作窃取、每个任务一个 goroutine 和扇出扇入三种方式
+func BenchmarkFib(b *testing.B) {
+	const n = 25
+
+	b.Run("forkjoin", func(b *testing.B) {
+		p := forkjoin.NewPool(0)
+		defer p.Close()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			fibForkJoin(p, n)
+		}
+		b.ReportMetric(float64(p.Steals())/float64(b.N), "steals/op")
+	})
+	b.Run("goroutines", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			fibGoroutines(n)
+		}
+	})
+	b.Run("fanIn", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			fibFanIn(n, 8)
+		}
+	})
+	b.Run("sequential", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			fib(n)
+		}
+	})
+}
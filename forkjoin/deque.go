@@ -0,0 +1,47 @@
+package forkjoin
+
+import "sync"
+
+// deque 每个 worker 自己的双端队列
+// worker 在底部压入和弹出任务（后进先出，有利于缓存），其他 worker 从顶部窃取任务（最早压入的任务，通常也是最大的任务）。
+type deque struct {
+	mu    sync.Mutex
+	tasks []task
+	head  int // 顶部，下一个被窃取的任务
+}
+
+// push 在底部压入任务
+func (d *deque) push(t task) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.head > 0 && d.head == len(d.tasks) { // 队列已经空了，重新使用底层数组
+		d.tasks, d.head = d.tasks[:0], 0
+	}
+	d.tasks = append(d.tasks, t)
+}
+
+// pop 从底部弹出任务，队列为空时返回 nil
+func (d *deque) pop() task {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.head == len(d.tasks) {
+		return nil
+	}
+	t := d.tasks[len(d.tasks)-1]
+	d.tasks[len(d.tasks)-1] = nil
+	d.tasks = d.tasks[:len(d.tasks)-1]
+	return t
+}
+
+// steal 从顶部窃取任务，队列为空时返回 nil
+func (d *deque) steal() task {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.head == len(d.tasks) {
+		return nil
+	}
+	t := d.tasks[d.head]
+	d.tasks[d.head] = nil
+	d.head++
+	return t
+}
@@ -0,0 +1,172 @@
+// Package forkjoin 基于工作窃取的 fork-join 任务运行时
+// 第六章工作窃取算法的实现：每个 worker 有自己的双端队列，
+// Fork 将任务压入当前 worker 队列的底部，空闲的 worker 从其他队列的顶部窃取任务，
+// Join 等待任务完成，等待期间当前 worker 继续执行其他任务而不是阻塞。
+package forkjoin
+
+import (
+	"math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// task 可以被 worker 执行的任务
+type task interface {
+	run(w *Worker)
+}
+
+// Task Fork 返回的任务，通过 Join 得到结果
+type Task[T any] struct {
+	fn     func(w *Worker) T
+	result T
+	done   int32 // 任务完成后设置为 1
+}
+
+func (t *Task[T]) run(w *Worker) {
+	t.result = t.fn(w)
+	atomic.StoreInt32(&t.done, 1)
+}
+
+// Fork 将 fn 作为一个任务压入 w 的队列，fn 可能被 w 或者其他窃取它的 worker 执行
+func Fork[T any](w *Worker, fn func(w *Worker) T) *Task[T] {
+	t := &Task[T]{fn: fn}
+	w.deque.push(t)
+	w.pool.signal()
+	return t
+}
+
+// Join 等待任务完成并返回结果，w 是调用 Join 的 worker
+// 任务还在 w 的队列中时，w 直接执行它；任务被窃取时，w 在等待期间执行其他任务。
+func (t *Task[T]) Join(w *Worker) T {
+	for atomic.LoadInt32(&t.done) == 0 {
+		if next := w.deque.pop(); next != nil {
+			next.run(w)
+			continue
+		}
+		if next := w.steal(); next != nil {
+			next.run(w)
+			continue
+		}
+		runtime.Gosched() // 任务正在被其他 worker 执行
+	}
+	return t.result
+}
+
+// Worker 执行任务的 worker，只能在它正在执行的任务中使用
+type Worker struct {
+	id    int
+	pool  *Pool
+	deque deque
+	rand  *rand.Rand
+}
+
+// ID 返回 worker 在 pool 中的编号
+func (w *Worker) ID() int {
+	return w.id
+}
+
+// steal 从一个随机的 worker 开始，依次尝试窃取其他 worker 的任务
+func (w *Worker) steal() task {
+	workers := w.pool.workers
+	start := w.rand.Intn(len(workers))
+	for i := range workers {
+		victim := workers[(start+i)%len(workers)]
+		if victim == w {
+			continue
+		}
+		if t := victim.deque.steal(); t != nil {
+			atomic.AddInt64(&w.pool.steals, 1)
+			return t
+		}
+	}
+	return nil
+}
+
+// loop worker 的主循环：先执行自己的任务，再窃取，都没有时等待新的任务
+func (w *Worker) loop() {
+	defer w.pool.wg.Done()
+	for {
+		t := w.deque.pop()
+		if t == nil {
+			t = w.steal()
+		}
+		if t != nil {
+			t.run(w)
+			continue
+		}
+		select {
+		case <-w.pool.quit:
+			return
+		case <-w.pool.wake:
+		}
+	}
+}
+
+// Pool 一组执行 fork-join 任务的 worker
+type Pool struct {
+	workers []*Worker
+	wake    chan struct{} // 有新任务时唤醒空闲的 worker
+	quit    chan struct{}
+	wg      sync.WaitGroup
+	next    uint32 // Run 提交根任务时轮流选择 worker
+	steals  int64
+}
+
+// NewPool 启动 workers 个 worker，workers 小于 1 时使用 runtime.GOMAXPROCS(0)
+func NewPool(workers int) *Pool {
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	p := &Pool{
+		workers: make([]*Worker, workers),
+		wake:    make(chan struct{}, workers),
+		quit:    make(chan struct{}),
+	}
+	for i := range p.workers {
+		p.workers[i] = &Worker{id: i, pool: p, rand: rand.New(rand.NewSource(int64(i)))}
+	}
+	p.wg.Add(workers)
+	for _, w := range p.workers {
+		go w.loop()
+	}
+	return p
+}
+
+// Close 停止所有 worker，正在运行的 Run 必须先返回
+func (p *Pool) Close() {
+	close(p.quit)
+	p.wg.Wait()
+}
+
+// Steals 返回任务被窃取的总次数
+func (p *Pool) Steals() int64 {
+	return atomic.LoadInt64(&p.steals)
+}
+
+// signal 唤醒一个空闲的 worker，缓冲区满时说明已经有足够的唤醒信号
+func (p *Pool) signal() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run 在 pool 中执行根任务 fn 并等待结果
+func Run[T any](p *Pool, fn func(w *Worker) T) T {
+	var result T
+	finished := make(chan struct{})
+	root := &Task[struct{}]{fn: func(w *Worker) struct{} {
+		defer close(finished)
+		result = fn(w)
+		return struct{}{}
+	}}
+
+	w := p.workers[atomic.AddUint32(&p.next, 1)%uint32(len(p.workers))]
+	w.deque.push(root)
+	for range p.workers { // 根任务可能被任何一个 worker 窃取
+		p.signal()
+	}
+	<-finished
+	return result
+}
@@ -0,0 +1,112 @@
+package forkjoin
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func fib(w *Worker, n int) int {
+	if n < 2 {
+		return n
+	}
+	t := Fork(w, func(w *Worker) int { return fib(w, n-1) })
+	return fib(w, n-2) + t.Join(w)
+}
+
+/*
+go test ./forkjoin -v -count=1 -run TestDeque
+*/
+// TestDeque 所有者后进先出，窃取者先进先出
+func TestDeque(t *testing.T) {
+	var d deque
+	tasks := make([]*Task[int], 4)
+	for i := range tasks {
+		tasks[i] = &Task[int]{}
+		d.push(tasks[i])
+	}
+	if got := d.pop(); got != tasks[3] {
+		t.Fatal("pop did not return the newest task")
+	}
+	if got := d.steal(); got != tasks[0] {
+		t.Fatal("steal did not return the oldest task")
+	}
+	d.steal()
+	d.pop()
+	if d.pop() != nil || d.steal() != nil {
+		t.Fatal("deque should be empty")
+	}
+	d.push(tasks[0])
+	if len(d.tasks) != 1 || d.head != 0 {
+		t.Fatalf("empty deque was not reset: len %d head %d", len(d.tasks), d.head)
+	}
+}
+
+/*
+go test ./forkjoin -v -count=1 -run TestRunFib
+*/
+func TestRunFib(t *testing.T) {
+	p := NewPool(4)
+	defer p.Close()
+
+	want := []int{0, 1, 1, 2, 3, 5, 8, 13, 21, 34, 55}
+	for n, v := range want {
+		if got := Run(p, func(w *Worker) int { return fib(w, n) }); got != v {
+			t.Fatalf("fib(%d) = %d, want %d", n, got, v)
+		}
+	}
+	if got := Run(p, func(w *Worker) int { return fib(w, 25) }); got != 75025 {
+		t.Fatalf("fib(25) = %d, want 75025", got)
+	}
+}
+
+/*
+go test ./forkjoin -v -count=1 -run TestWorkIsStolen
+*/
+// TestWorkIsStolen 根任务 fork 的任务会阻塞一段时间，其他 worker 应该窃取并执行一部分
+func TestWorkIsStolen(t *testing.T) {
+	p := NewPool(4)
+	defer p.Close()
+
+	ids := Run(p, func(w *Worker) map[int]bool {
+		var mu sync.Mutex
+		ids := make(map[int]bool)
+		tasks := make([]*Task[struct{}], 16)
+		for i := range tasks {
+			tasks[i] = Fork(w, func(w *Worker) struct{} {
+				time.Sleep(time.Millisecond)
+				mu.Lock()
+				defer mu.Unlock()
+				ids[w.ID()] = true
+				return struct{}{}
+			})
+		}
+		for _, task := range tasks {
+			task.Join(w)
+		}
+		return ids
+	})
+	if len(ids) < 2 || p.Steals() == 0 {
+		t.Fatalf("tasks ran on workers %v with %d steals, want work spread by stealing", ids, p.Steals())
+	}
+}
+
+/*
+go test ./forkjoin -v -count=1 -run TestConcurrentRun
+*/
+func TestConcurrentRun(t *testing.T) {
+	p := NewPool(0)
+	defer p.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got := Run(p, func(w *Worker) int { return fib(w, 20) }); got != 6765 {
+				t.Errorf("fib(20) = %d, want 6765", got)
+			}
+		}()
+	}
+	wg.Wait()
+}
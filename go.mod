@@ -1,3 +1,3 @@
 module concurrency_in_go
 
-go 1.13
+go 1.21
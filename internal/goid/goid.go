@@ -0,0 +1,24 @@
+// Package goid 解析当前 goroutine 的编号，供需要区分 goroutine 的锁和检测工具使用
+package goid
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strconv"
+)
+
+// Get 返回当前 goroutine 的编号，运行时没有公开这个编号，只能从栈的第一行中解析
+func Get() int64 {
+	var buf [64]byte
+	n := runtime.Stack(buf[:], false)
+	field := bytes.TrimPrefix(buf[:n], []byte("goroutine "))
+	if i := bytes.IndexByte(field, ' '); i > 0 {
+		field = field[:i]
+	}
+	id, err := strconv.ParseInt(string(field), 10, 64)
+	if err != nil {
+		panic(fmt.Sprintf("goid: cannot parse goroutine id: %v", err))
+	}
+	return id
+}
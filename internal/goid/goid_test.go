@@ -0,0 +1,20 @@
+package goid
+
+import "testing"
+
+/*
+go test ./internal/goid -v -count=1 -run TestGet
+*/
+// TestGet 同一个 goroutine 的编号不变，不同 goroutine 的编号不同
+func TestGet(t *testing.T) {
+	id := Get()
+	if id <= 0 || Get() != id {
+		t.Fatalf("unstable goroutine id %d", id)
+	}
+
+	other := make(chan int64)
+	go func() { other <- Get() }()
+	if got := <-other; got == id || got <= 0 {
+		t.Fatalf("goroutine ids %d and %d should differ", id, got)
+	}
+}
@@ -0,0 +1,157 @@
+// Package leaktest 检查测试中泄漏的 goroutine
+// 测试开始时记录所有正在运行的 goroutine，测试结束时再检查一次，
+// 测试结束后仍然存在的新 goroutine 就是泄漏的 goroutine。
+// 运行时和 testing 包自己的 goroutine 会被忽略。
+//
+// 使用 t.Parallel() 的测试会互相看到对方的 goroutine，不能使用本包检查。
+package leaktest
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Timeout 测试结束后等待 goroutine 退出的默认时间
+const Timeout = time.Second
+
+// ignoredPrefixes 这些包中的函数启动或者正在执行的 goroutine 不属于被测试的代码
+var ignoredPrefixes = []string{
+	"testing.",
+	"runtime.",
+	"os/signal.",
+	"runtime/trace.",
+}
+
+// Goroutine 一个 goroutine 的栈
+type Goroutine struct {
+	ID    int
+	State string // 例如 "chan receive"、"select"
+	Top   string // 栈顶的函数
+	Stack string // 完整的栈
+}
+
+func (g Goroutine) String() string {
+	return g.Stack
+}
+
+// Snapshot 某一时刻正在运行的 goroutine
+type Snapshot map[int]Goroutine
+
+// Take 记录当前正在运行的 goroutine
+func Take() Snapshot {
+	s := make(Snapshot)
+	for _, g := range goroutines() {
+		s[g.ID] = g
+	}
+	return s
+}
+
+// Leaks 返回 s 之后启动且仍然存在的 goroutine
+// 最多等待 timeout，让正在退出的 goroutine 有机会退出。
+func (s Snapshot) Leaks(timeout time.Duration) []Goroutine {
+	deadline := time.Now().Add(timeout)
+	for wait := time.Millisecond; ; wait *= 2 {
+		var leaks []Goroutine
+		for _, g := range goroutines() {
+			if _, ok := s[g.ID]; !ok && !ignored(g) {
+				leaks = append(leaks, g)
+			}
+		}
+		if len(leaks) == 0 || time.Now().After(deadline) {
+			return leaks
+		}
+		time.Sleep(min(wait, time.Until(deadline), 100*time.Millisecond))
+	}
+}
+
+// VerifyNoLeaks 在测试结束时检查泄漏的 goroutine，发现泄漏时测试失败并打印它们的栈
+// 应该在测试的第一行调用，检查在 t.Cleanup 中进行，所以晚于测试中注册的其他 Cleanup（例如关闭 httptest.Server）。
+func VerifyNoLeaks(t testing.TB) {
+	t.Helper()
+	before := Take()
+	t.Cleanup(func() {
+		if t.Failed() {
+			return // 失败的测试可能没有机会清理，泄漏只会掩盖真正的错误
+		}
+		if leaks := before.Leaks(Timeout); len(leaks) > 0 {
+			t.Errorf("found %d leaked goroutine(s):\n\n%s", len(leaks), format(leaks))
+		}
+	})
+}
+
+func format(leaks []Goroutine) string {
+	stacks := make([]string, len(leaks))
+	for i, g := range leaks {
+		stacks[i] = g.Stack
+	}
+	return strings.Join(stacks, "\n\n")
+}
+
+// ignored goroutine 是否属于运行时或者 testing 包
+func ignored(g Goroutine) bool {
+	for _, prefix := range ignoredPrefixes {
+		if strings.HasPrefix(g.Top, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// goroutines 解析 runtime.Stack 的输出，不包括调用者自己
+func goroutines() []Goroutine {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	var gs []Goroutine
+	for i, block := range bytes.Split(buf, []byte("\n\n")) {
+		g, err := parse(string(block))
+		if err != nil {
+			panic(fmt.Sprintf("leaktest: %v", err))
+		}
+		if i == 0 { // 第一个总是调用者自己
+			continue
+		}
+		gs = append(gs, g)
+	}
+	return gs
+}
+
+// parse 解析一个 goroutine 的栈，第一行的格式为 "goroutine 18 [chan receive, 1 minutes]:"
+func parse(stack string) (Goroutine, error) {
+	header, frames, _ := strings.Cut(stack, "\n")
+	rest, ok := strings.CutPrefix(header, "goroutine ")
+	if !ok {
+		return Goroutine{}, fmt.Errorf("unexpected goroutine header %q", header)
+	}
+	id, state, ok := strings.Cut(rest, " [")
+	if !ok {
+		return Goroutine{}, fmt.Errorf("unexpected goroutine header %q", header)
+	}
+	g := Goroutine{Stack: stack}
+	var err error
+	if g.ID, err = strconv.Atoi(id); err != nil {
+		return Goroutine{}, fmt.Errorf("unexpected goroutine id in %q", header)
+	}
+	g.State, _, _ = strings.Cut(strings.TrimSuffix(state, "]:"), ",")
+
+	// 栈顶的函数，例如 "main.worker(0xc000010000)" 或者 "created by main.main"
+	if top, _, _ := strings.Cut(frames, "\n"); !strings.HasPrefix(top, "created by ") {
+		if i := strings.LastIndex(top, "("); i > 0 {
+			top = top[:i]
+		}
+		g.Top = top
+	}
+	return g, nil
+}
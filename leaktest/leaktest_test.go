@@ -0,0 +1,95 @@
+package leaktest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+/*
+go test ./leaktest -v -count=1 -run TestLeaks
+*/
+func TestLeaks(t *testing.T) {
+	before := Take()
+	block := make(chan struct{})
+	go func() { <-block }()
+
+	leaks := before.Leaks(20 * time.Millisecond)
+	if len(leaks) != 1 || leaks[0].State != "chan receive" || !strings.Contains(leaks[0].Top, "TestLeaks") {
+		t.Fatalf("got leaks %v, want the blocked goroutine", leaks)
+	}
+
+	close(block)
+	if leaks := before.Leaks(Timeout); len(leaks) != 0 {
+		t.Fatalf("got leaks %v after the goroutine exited", leaks)
+	}
+}
+
+/*
+go test ./leaktest -v -count=1 -run TestVerifyNoLeaks
+*/
+// TestVerifyNoLeaks 测试结束前正在退出的 goroutine 不算泄漏
+func TestVerifyNoLeaks(t *testing.T) {
+	VerifyNoLeaks(t)
+	go time.Sleep(10 * time.Millisecond)
+}
+
+// fakeTB 记录 Errorf 并由测试手动运行 Cleanup 的 testing.TB
+// 嵌入 testing.TB 只是为了满足接口，VerifyNoLeaks 用到的方法都在这里实现。
+type fakeTB struct {
+	testing.TB
+	cleanups []func()
+	errors   []string
+}
+
+func (f *fakeTB) Helper()           {}
+func (f *fakeTB) Cleanup(fn func()) { f.cleanups = append(f.cleanups, fn) }
+func (f *fakeTB) Failed() bool      { return len(f.errors) > 0 }
+func (f *fakeTB) Errorf(format string, args ...any) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+// finish 和 testing 包一样按照注册的相反顺序运行 Cleanup
+func (f *fakeTB) finish() {
+	for i := len(f.cleanups) - 1; i >= 0; i-- {
+		f.cleanups[i]()
+	}
+}
+
+/*
+go test ./leaktest -v -count=1 -run TestVerifyNoLeaksReportsLeak
+*/
+// TestVerifyNoLeaksReportsLeak 测试结束后仍然阻塞的 goroutine 要被报告，并且打印它的栈
+func TestVerifyNoLeaksReportsLeak(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	tb := &fakeTB{}
+	VerifyNoLeaks(tb)
+	go func() { <-block }()
+	tb.finish()
+
+	if len(tb.errors) != 1 {
+		t.Fatalf("got errors %q, want one leak report", tb.errors)
+	}
+	if report := tb.errors[0]; !strings.Contains(report, "found 1 leaked goroutine(s)") || !strings.Contains(report, "TestVerifyNoLeaksReportsLeak") {
+		t.Fatalf("report does not show the leaked goroutine:\n%s", report)
+	}
+}
+
+/*
+go test ./leaktest -v -count=1 -run TestParse
+*/
+func TestParse(t *testing.T) {
+	g, err := parse("goroutine 18 [chan send, 2 minutes]:\nmain.worker(0xc000010000)\n\t/tmp/main.go:12 +0x1d\ncreated by main.main in goroutine 1\n\t/tmp/main.go:20 +0x25")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.ID != 18 || g.State != "chan send" || g.Top != "main.worker" {
+		t.Fatalf("got %+v", g)
+	}
+	if _, err := parse("not a goroutine"); err == nil {
+		t.Fatal("expected an error for a malformed header")
+	}
+}
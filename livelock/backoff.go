@@ -0,0 +1,71 @@
+package livelock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// ErrGaveUp Retry 用完了所有的尝试次数
+var ErrGaveUp = errors.New("livelock: gave up after max attempts")
+
+// Backoff 带有随机抖动的指数退避
+// 第 n 次失败之后等待 [0, min(Max, Base*2^(n-1))) 之间的随机时间（full jitter）。
+// 固定的等待时间不能解决活锁：双方同时失败，等待同样长的时间，又会同时重试。
+type Backoff struct {
+	Base        time.Duration // 第一次失败之后等待时间的上限
+	Max         time.Duration // 等待时间的上限，0 表示只受 time.Duration 的范围限制
+	MaxAttempts int           // Retry 最多尝试的次数，0 表示不限制
+
+	// Rand 随机数的来源，为 nil 时使用 math/rand 的全局来源
+	// *rand.Rand 不能在多个 goroutine 中使用，每个 goroutine 需要自己的 Backoff。
+	Rand *rand.Rand
+}
+
+// Delay 返回第 attempt 次失败之后等待的时间，attempt 从 1 开始
+func (b Backoff) Delay(attempt int) time.Duration {
+	ceiling := b.Base
+	for i := 1; i < attempt && (b.Max <= 0 || ceiling < b.Max); i++ {
+		if ceiling > math.MaxInt64/2 { // 再翻倍就会溢出
+			ceiling = math.MaxInt64
+			break
+		}
+		ceiling *= 2
+	}
+	if b.Max > 0 && ceiling > b.Max {
+		ceiling = b.Max
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	if b.Rand != nil {
+		return time.Duration(b.Rand.Int63n(int64(ceiling)))
+	}
+	return time.Duration(rand.Int63n(int64(ceiling)))
+}
+
+// Retry 调用 fn 直到它返回 nil，每次失败之后按照 b 退避，返回尝试的次数
+// 用完 b.MaxAttempts 次尝试时返回包装了 ErrGaveUp 和最后一个错误的错误；
+// ctx 取消时返回 ctx.Err()。
+func Retry(ctx context.Context, b Backoff, fn func(attempt int) error) (int, error) {
+	for attempt := 1; ; attempt++ {
+		err := fn(attempt)
+		if err == nil {
+			return attempt, nil
+		}
+		if b.MaxAttempts > 0 && attempt >= b.MaxAttempts {
+			return attempt, fmt.Errorf("%w: %w", ErrGaveUp, err)
+		}
+
+		timer := time.NewTimer(b.Delay(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package livelock
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+/*
+go test ./livelock -v -count=1 -run TestDelay
+*/
+func TestDelay(t *testing.T) {
+	b := Backoff{Base: 10 * time.Millisecond, Max: 50 * time.Millisecond, Rand: rand.New(rand.NewSource(1))}
+	ceilings := []time.Duration{10, 20, 40, 50, 50}
+	for i, ceiling := range ceilings {
+		ceiling *= time.Millisecond
+		for j := 0; j < 100; j++ {
+			if d := b.Delay(i + 1); d < 0 || d >= ceiling {
+				t.Fatalf("attempt %d: delay %v outside [0, %v)", i+1, d, ceiling)
+			}
+		}
+	}
+
+	// 相同的种子得到相同的抖动，不同的种子打破对称
+	alice := Backoff{Base: time.Second, Rand: rand.New(rand.NewSource(1))}
+	barbara := Backoff{Base: time.Second, Rand: rand.New(rand.NewSource(2))}
+	if alice.Delay(1) == barbara.Delay(1) {
+		t.Fatal("different sources produced the same delay")
+	}
+	if (Backoff{}).Delay(3) != 0 {
+		t.Fatal("zero Backoff should not wait")
+	}
+
+	// 没有上限时翻倍到 time.Duration 的最大值为止，不能溢出为 0 之后不再等待
+	unbounded := Backoff{Base: time.Millisecond, Rand: rand.New(rand.NewSource(1))}
+	var longest time.Duration
+	for j := 0; j < 10; j++ {
+		d := unbounded.Delay(100)
+		if d <= 0 {
+			t.Fatalf("attempt 100 without Max: delay %v, want positive", d)
+		}
+		longest = max(longest, d)
+	}
+	if longest < 24*time.Hour {
+		t.Fatalf("attempt 100 without Max: longest delay %v, want the ceiling near the Duration limit", longest)
+	}
+}
+
+/*
+go test ./livelock -v -count=1 -run TestRetry
+*/
+func TestRetry(t *testing.T) {
+	errBusy := errors.New("busy")
+	b := Backoff{Base: time.Millisecond, MaxAttempts: 5}
+
+	attempts, err := Retry(context.Background(), b, func(attempt int) error {
+		if attempt < 3 {
+			return errBusy
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Fatalf("got %d attempts, err %v, want 3 and nil", attempts, err)
+	}
+
+	attempts, err = Retry(context.Background(), b, func(int) error { return errBusy })
+	if attempts != 5 || !errors.Is(err, ErrGaveUp) || !errors.Is(err, errBusy) {
+		t.Fatalf("got %d attempts, err %v, want 5 and ErrGaveUp", attempts, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Retry(ctx, Backoff{Base: time.Hour}, func(int) error { return errBusy }); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+}
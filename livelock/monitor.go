@@ -0,0 +1,126 @@
+// Package livelock 发现和避免活锁
+// 活锁中的 goroutine 一直在忙碌，却没有推进程序的状态，所以单纯的心跳发现不了它。
+// Monitor 分别记录“忙碌”和“进展”，忙碌了一段时间却没有进展的 goroutine 就是可疑的活锁；
+// Backoff 和 Retry 在重试之间等待随机的时间，打破参与者之间的对称，让活锁自行解开。
+package livelock
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stall 一个忙碌却没有进展的 worker
+type Stall struct {
+	Worker string        // worker 的名字
+	Busy   int64         // 上一次进展之后忙碌的次数
+	Since  time.Duration // 距离上一次进展的时间
+}
+
+// Tracker 记录一个 worker 的忙碌和进展，可以在多个 goroutine 中使用
+type Tracker struct {
+	name         string
+	busy         int64 // 上一次进展之后忙碌的次数
+	progress     int64 // 进展的次数
+	lastProgress int64 // 上一次进展的时间，UnixNano
+}
+
+// Busy 记录一次忙碌，例如一次尝试、一次重试或者一次循环
+func (t *Tracker) Busy() {
+	atomic.AddInt64(&t.busy, 1)
+}
+
+// Progress 记录一次进展，例如一次成功的尝试或者状态的改变
+func (t *Tracker) Progress() {
+	atomic.StoreInt64(&t.busy, 0)
+	atomic.StoreInt64(&t.lastProgress, time.Now().UnixNano())
+	atomic.AddInt64(&t.progress, 1)
+}
+
+// Monitor 监视一组 worker，找出忙碌了 window 却没有进展的 worker
+type Monitor struct {
+	window time.Duration
+
+	mu      sync.Mutex
+	workers map[string]*Tracker
+}
+
+// NewMonitor 返回一个新的 Monitor
+func NewMonitor(window time.Duration) *Monitor {
+	return &Monitor{window: window, workers: make(map[string]*Tracker)}
+}
+
+// Track 开始监视名为 name 的 worker，开始监视的时刻算作一次进展
+func (m *Monitor) Track(name string) *Tracker {
+	t := &Tracker{name: name, lastProgress: time.Now().UnixNano()}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.workers[name] = t
+	return t
+}
+
+// Untrack 停止监视名为 name 的 worker，例如 worker 已经完成了工作
+func (m *Monitor) Untrack(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.workers, name)
+}
+
+// Stalled 返回忙碌了 window 以上却没有进展的 worker，按名字排序
+// 没有忙碌的 worker 只是空闲或者阻塞，不算活锁。
+func (m *Monitor) Stalled() []Stall {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var stalls []Stall
+	for name, t := range m.workers {
+		busy := atomic.LoadInt64(&t.busy)
+		since := now.Sub(time.Unix(0, atomic.LoadInt64(&t.lastProgress)))
+		if busy > 0 && since >= m.window {
+			stalls = append(stalls, Stall{Worker: name, Busy: busy, Since: since})
+		}
+	}
+	sort.Slice(stalls, func(i, j int) bool { return stalls[i].Worker < stalls[j].Worker })
+	return stalls
+}
+
+// Watch 每隔 interval 检查一次，新发现的 Stall 发送到返回的 channel
+// 同一个 worker 在下一次进展之前只报告一次。done 关闭后返回的 channel 被关闭。
+func (m *Monitor) Watch(done <-chan struct{}, interval time.Duration) <-chan Stall {
+	stalls := make(chan Stall)
+	go func() {
+		defer close(stalls)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		reported := make(map[string]int64) // worker 被报告时的进展次数
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			for _, s := range m.Stalled() {
+				m.mu.Lock()
+				t := m.workers[s.Worker]
+				m.mu.Unlock()
+				if t == nil {
+					continue
+				}
+				progress := atomic.LoadInt64(&t.progress)
+				if p, ok := reported[s.Worker]; ok && p == progress {
+					continue
+				}
+				reported[s.Worker] = progress
+				select {
+				case <-done:
+					return
+				case stalls <- s:
+				}
+			}
+		}
+	}()
+	return stalls
+}
@@ -0,0 +1,69 @@
+package livelock
+
+import (
+	"testing"
+	"time"
+)
+
+/*
+go test ./livelock -v -count=1 -run TestStalled
+*/
+// TestStalled 只有忙碌却没有进展的 worker 被报告，空闲的和有进展的 worker 不会
+func TestStalled(t *testing.T) {
+	m := NewMonitor(20 * time.Millisecond)
+	spinning := m.Track("spinning")
+	m.Track("idle")
+	working := m.Track("working")
+
+	for i := 0; i < 3; i++ {
+		spinning.Busy()
+		working.Busy()
+	}
+	time.Sleep(30 * time.Millisecond)
+	working.Progress()
+
+	stalls := m.Stalled()
+	if len(stalls) != 1 || stalls[0].Worker != "spinning" || stalls[0].Busy != 3 {
+		t.Fatalf("got %+v, want only spinning with 3 busy", stalls)
+	}
+
+	spinning.Progress()
+	if stalls := m.Stalled(); len(stalls) != 0 {
+		t.Fatalf("got %+v after progress", stalls)
+	}
+	m.Untrack("spinning")
+}
+
+/*
+go test ./livelock -v -count=1 -run TestWatch
+*/
+// TestWatch 同一个 worker 在下一次进展之前只报告一次
+func TestWatch(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	m := NewMonitor(10 * time.Millisecond)
+	w := m.Track("w")
+	w.Busy()
+	stalls := m.Watch(done, 5*time.Millisecond)
+
+	if s := <-stalls; s.Worker != "w" {
+		t.Fatalf("got %+v, want w", s)
+	}
+	select {
+	case s := <-stalls:
+		t.Fatalf("got %+v reported twice", s)
+	case <-time.After(30 * time.Millisecond):
+	}
+
+	w.Progress()
+	w.Busy()
+	select {
+	case s := <-stalls:
+		if s.Worker != "w" || s.Busy != 1 {
+			t.Fatalf("got %+v, want w with 1 busy", s)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("stall after progress was not reported")
+	}
+}
@@ -0,0 +1,202 @@
+// Package lockorder 检查加锁顺序不一致导致的潜在死锁
+// Mutex 是 sync.Mutex 的替代品，它记录每个 goroutine 持有的锁：
+// 持有 a 的同时获取 b，就在加锁顺序图中添加一条 a → b 的边。
+// 新的边和已有的边构成环时（例如另一个 goroutine 曾经持有 b 的同时获取 a），
+// 说明存在满足循环等待条件的加锁顺序，即使这一次运行没有真的发生死锁，也会报告出来。
+package lockorder
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+	"strings"
+	"sync"
+
+	"concurrency_in_go/internal/goid"
+)
+
+// Cycle 加锁顺序图中的一个环
+type Cycle struct {
+	Locks    []string // 环上的锁，Locks[0] 是现在要获取的锁，最后一个是已经持有的锁
+	Previous []byte   // 第一次持有 Locks[0] 获取 Locks[1] 时的栈，即相反的加锁顺序
+	Current  []byte   // 持有最后一个锁的同时获取 Locks[0] 的栈
+}
+
+func (c *Cycle) String() string {
+	first, second, last := c.Locks[0], c.Locks[1], c.Locks[len(c.Locks)-1]
+	var b strings.Builder
+	fmt.Fprintf(&b, "lockorder: potential deadlock, inconsistent lock order %s -> %s\n", strings.Join(c.Locks, " -> "), first)
+	fmt.Fprintf(&b, "\nprevious acquisition (%s held, acquiring %s):\n%s", first, second, c.Previous)
+	fmt.Fprintf(&b, "\ncurrent acquisition (%s held, acquiring %s):\n%s", last, first, c.Current)
+	return b.String()
+}
+
+// Detector 记录加锁顺序图，可以有多个相互独立的 Detector
+type Detector struct {
+	onCycle func(*Cycle)
+
+	mu       sync.Mutex
+	edges    map[*Mutex]map[*Mutex][]byte // edges[a][b] 第一次持有 a 获取 b 时的栈
+	held     map[int64][]*Mutex           // 每个 goroutine 持有的锁
+	reported map[[2]*Mutex]bool
+	cycles   []*Cycle
+}
+
+// NewDetector 返回一个新的 Detector，每个环第一次出现时调用 onCycle
+// onCycle 为 nil 时使用 log 打印环。
+func NewDetector(onCycle func(*Cycle)) *Detector {
+	if onCycle == nil {
+		onCycle = func(c *Cycle) { log.Print(c) }
+	}
+	return &Detector{
+		onCycle:  onCycle,
+		edges:    make(map[*Mutex]map[*Mutex][]byte),
+		held:     make(map[int64][]*Mutex),
+		reported: make(map[[2]*Mutex]bool),
+	}
+}
+
+// defaultDetector 零值的 Mutex 使用的 Detector
+var defaultDetector = NewDetector(nil)
+
+// NewMutex 返回由 d 检查的 Mutex，name 用于报告
+func (d *Detector) NewMutex(name string) *Mutex {
+	return &Mutex{Name: name, detector: d}
+}
+
+// Cycles 返回到目前为止发现的所有环
+func (d *Detector) Cycles() []*Cycle {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]*Cycle(nil), d.cycles...)
+}
+
+// Mutex 记录加锁顺序的互斥锁，实现了 sync.Locker
+// 零值可以直接使用，由包级别的 Detector 检查，发现的环通过 log 打印。
+type Mutex struct {
+	Name string // 报告中使用的名字，为空时使用地址
+
+	mu       sync.Mutex
+	detector *Detector
+}
+
+var _ sync.Locker = (*Mutex)(nil)
+
+// Lock 获取锁之前检查加锁顺序
+func (m *Mutex) Lock() {
+	d := m.getDetector()
+	gid := goid.Get()
+	d.acquire(gid, m)
+	m.mu.Lock()
+
+	d.mu.Lock()
+	d.held[gid] = append(d.held[gid], m)
+	d.mu.Unlock()
+}
+
+// Unlock 释放锁
+// 和 sync.Mutex 一样，允许由另一个 goroutine 释放。
+func (m *Mutex) Unlock() {
+	d := m.getDetector()
+	d.release(goid.Get(), m)
+	m.mu.Unlock()
+}
+
+func (m *Mutex) getDetector() *Detector {
+	if m.detector == nil {
+		return defaultDetector
+	}
+	return m.detector
+}
+
+func (m *Mutex) String() string {
+	if m.Name != "" {
+		return m.Name
+	}
+	return fmt.Sprintf("%p", m)
+}
+
+// acquire goroutine gid 将要获取 m，为它持有的每个锁添加一条指向 m 的边
+func (d *Detector) acquire(gid int64, m *Mutex) {
+	d.mu.Lock()
+	var found []*Cycle
+	for _, h := range d.held[gid] {
+		if h == m || d.edges[h][m] != nil {
+			continue // 重复加锁由 sync.Mutex 自己死锁；已知的边不需要再检查
+		}
+		stack := debug.Stack()
+		if path := d.path(m, h); path != nil && !d.reported[[2]*Mutex{h, m}] {
+			d.reported[[2]*Mutex{h, m}] = true
+			d.reported[[2]*Mutex{m, h}] = true
+			c := &Cycle{Previous: d.edges[path[0]][path[1]], Current: stack}
+			for _, l := range path {
+				c.Locks = append(c.Locks, l.String())
+			}
+			d.cycles = append(d.cycles, c)
+			found = append(found, c)
+		}
+		if d.edges[h] == nil {
+			d.edges[h] = make(map[*Mutex][]byte)
+		}
+		d.edges[h][m] = stack
+	}
+	d.mu.Unlock()
+
+	for _, c := range found { // 不持有 d.mu 时调用，onCycle 中可以使用其他 Mutex
+		d.onCycle(c)
+	}
+}
+
+// release 从 gid 持有的锁中删除 m
+// 由其他 goroutine 获取的锁从获取它的 goroutine 中删除。
+func (d *Detector) release(gid int64, m *Mutex) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.remove(gid, m) {
+		return
+	}
+	for other := range d.held {
+		if d.remove(other, m) {
+			return
+		}
+	}
+}
+
+func (d *Detector) remove(gid int64, m *Mutex) bool {
+	held := d.held[gid]
+	for i := len(held) - 1; i >= 0; i-- {
+		if held[i] == m {
+			held = append(held[:i], held[i+1:]...)
+			if len(held) == 0 {
+				delete(d.held, gid)
+			} else {
+				d.held[gid] = held
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// path 在加锁顺序图中查找从 from 到 to 的路径，没有路径时返回 nil
+func (d *Detector) path(from, to *Mutex) []*Mutex {
+	visited := map[*Mutex]bool{from: true}
+	var dfs func(path []*Mutex) []*Mutex
+	dfs = func(path []*Mutex) []*Mutex {
+		last := path[len(path)-1]
+		if last == to {
+			return path
+		}
+		for next := range d.edges[last] {
+			if visited[next] {
+				continue
+			}
+			visited[next] = true
+			if found := dfs(append(path, next)); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+	return dfs([]*Mutex{from})
+}
@@ -0,0 +1,126 @@
+package lockorder
+
+import (
+	"bytes"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// lockInOrder 依次获取 locks，然后按相反的顺序释放
+func lockInOrder(locks ...sync.Locker) {
+	for _, l := range locks {
+		l.Lock()
+	}
+	for i := len(locks) - 1; i >= 0; i-- {
+		locks[i].Unlock()
+	}
+}
+
+func lockAB(a, b *Mutex) { lockInOrder(a, b) }
+
+func lockBA(a, b *Mutex) { lockInOrder(b, a) }
+
+/*
+go test ./lockorder -v -count=1 -run TestInconsistentOrder
+*/
+// TestInconsistentOrder 两个 goroutine 先后以相反的顺序加锁，没有真的死锁，但是环会被报告
+func TestInconsistentOrder(t *testing.T) {
+	var reported []*Cycle
+	d := NewDetector(func(c *Cycle) { reported = append(reported, c) })
+	a, b := d.NewMutex("a"), d.NewMutex("b")
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		lockAB(a, b)
+	}()
+	wg.Wait()
+	if len(reported) != 0 {
+		t.Fatalf("got %d cycles after a single lock order", len(reported))
+	}
+
+	lockBA(a, b)
+	if len(reported) != 1 {
+		t.Fatalf("got %d cycles, want 1", len(reported))
+	}
+	c := reported[0]
+	if !reflect.DeepEqual(c.Locks, []string{"a", "b"}) {
+		t.Fatalf("got locks %v, want [a b]", c.Locks)
+	}
+	if !bytes.Contains(c.Previous, []byte("lockAB")) || !bytes.Contains(c.Current, []byte("lockBA")) {
+		t.Fatalf("stacks do not show both acquisitions:\n%s", c)
+	}
+
+	// 同一个环只报告一次
+	lockBA(a, b)
+	lockAB(a, b)
+	if len(d.Cycles()) != 1 {
+		t.Fatalf("got %d cycles, want the cycle reported once", len(d.Cycles()))
+	}
+}
+
+/*
+go test ./lockorder -v -count=1 -run TestConsistentOrder
+*/
+func TestConsistentOrder(t *testing.T) {
+	d := NewDetector(func(c *Cycle) { t.Errorf("unexpected cycle:\n%s", c) })
+	a, b, c := d.NewMutex("a"), d.NewMutex("b"), d.NewMutex("c")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			lockInOrder(a, b, c)
+		}()
+		go func() {
+			defer wg.Done()
+			lockInOrder(a, c)
+		}()
+	}
+	wg.Wait()
+}
+
+/*
+go test ./lockorder -v -count=1 -run TestLongCycle
+*/
+// TestLongCycle a → b、b → c 之后获取 c → a 形成三个锁的环
+func TestLongCycle(t *testing.T) {
+	d := NewDetector(func(*Cycle) {})
+	a, b, c := d.NewMutex("a"), d.NewMutex("b"), d.NewMutex("c")
+	lockInOrder(a, b)
+	lockInOrder(b, c)
+	lockInOrder(c, a)
+
+	cycles := d.Cycles()
+	if len(cycles) != 1 || !reflect.DeepEqual(cycles[0].Locks, []string{"a", "b", "c"}) {
+		t.Fatalf("got %v, want the cycle a -> b -> c", cycles)
+	}
+}
+
+/*
+go test ./lockorder -v -count=1 -run TestUnlockFromOtherGoroutine
+*/
+// TestUnlockFromOtherGoroutine 和 sync.Mutex 一样，锁可以由另一个 goroutine 释放
+func TestUnlockFromOtherGoroutine(t *testing.T) {
+	d := NewDetector(func(c *Cycle) { t.Errorf("unexpected cycle:\n%s", c) })
+	a, b := d.NewMutex("a"), d.NewMutex("b")
+
+	a.Lock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		a.Unlock()
+	}()
+	<-done
+	lockInOrder(b, a) // a 已经释放，不会产生 a → b 的边
+	lockInOrder(b, a)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.held) != 0 {
+		t.Fatalf("locks still recorded as held: %v", d.held)
+	}
+}
@@ -0,0 +1,42 @@
+package lockprof
+
+import "time"
+
+// Histogram 时间的直方图
+// Counts[i] 是落在 (Bounds[i-1], Bounds[i]] 中的次数，最后一个桶记录超过所有上界的次数。
+type Histogram struct {
+	Bounds []time.Duration `json:"bounds"`
+	Counts []int64         `json:"counts"`
+	Count  int64           `json:"count"`
+	Sum    time.Duration   `json:"sum"`
+	Max    time.Duration   `json:"max"`
+}
+
+func newHistogram(bounds []time.Duration) *Histogram {
+	return &Histogram{Bounds: bounds, Counts: make([]int64, len(bounds)+1)}
+}
+
+func (h *Histogram) observe(d time.Duration) {
+	i := 0
+	for i < len(h.Bounds) && d > h.Bounds[i] {
+		i++
+	}
+	h.Counts[i]++
+	h.Count++
+	h.Sum += d
+	h.Max = max(h.Max, d)
+}
+
+// Mean 平均值
+func (h Histogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+func (h *Histogram) clone() Histogram {
+	c := *h
+	c.Counts = append([]int64(nil), h.Counts...)
+	return c
+}
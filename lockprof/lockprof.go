@@ -0,0 +1,254 @@
+// Package lockprof 锁竞争分析
+// 第三章 mutexExample2 通过 sync.Locker 比较 Mutex 和 RWMutex 的性能，
+// 本包提供同样可以替换 sync.Locker 和 sync.RWMutex 的包装，记录：
+//   - 读锁和写锁的获取次数、发生竞争的次数以及同时持有读锁的最大数量
+//   - 等待时间和写锁持有时间的直方图
+//   - 按持有者的调用栈采样的竞争情况（造成等待的一方获取锁时的调用栈、次数和等待时间）
+//
+// 结果可以导出为 JSON，也可以导出为 pprof 格式，使用 go tool pprof 分析。
+package lockprof
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Options Profile 的配置
+type Options struct {
+	// SampleEvery 每 SampleEvery 次发生竞争的获取记录一次调用栈，小于 1 时按 1 处理
+	SampleEvery int
+	// Buckets 直方图的桶的上界，为空时使用 DefaultBuckets
+	Buckets []time.Duration
+}
+
+// DefaultBuckets 默认的直方图的桶：1µs 到 1s，每个桶是上一个的 10 倍
+var DefaultBuckets = []time.Duration{
+	time.Microsecond, 10 * time.Microsecond, 100 * time.Microsecond,
+	time.Millisecond, 10 * time.Millisecond, 100 * time.Millisecond, time.Second,
+}
+
+// Profile 收集一个或者多个锁的竞争情况，可以在多个 goroutine 中使用
+type Profile struct {
+	name        string
+	sampleEvery int64
+	start       time.Time
+
+	contended      int64 // 发生竞争的获取次数，用于采样
+	readers        int64 // 当前持有读锁的数量
+	maxReaders     int64
+	mu             sync.Mutex
+	readAcquired   int64
+	writeAcquired  int64
+	readContended  int64
+	writeContended int64
+	readWait       *Histogram
+	writeWait      *Histogram
+	writeHold      *Histogram
+	stacks         map[stack]*stackSample
+}
+
+// NewProfile 返回名为 name 的 Profile
+func NewProfile(name string, opts Options) *Profile {
+	if opts.SampleEvery < 1 {
+		opts.SampleEvery = 1
+	}
+	if len(opts.Buckets) == 0 {
+		opts.Buckets = DefaultBuckets
+	}
+	return &Profile{
+		name:        name,
+		sampleEvery: int64(opts.SampleEvery),
+		start:       time.Now(),
+		readWait:    newHistogram(opts.Buckets),
+		writeWait:   newHistogram(opts.Buckets),
+		writeHold:   newHistogram(opts.Buckets),
+		stacks:      make(map[stack]*stackSample),
+	}
+}
+
+// Name 返回 Profile 的名字
+func (p *Profile) Name() string {
+	return p.name
+}
+
+// tryLocker 标准库中的锁都实现了 TryLock，用它判断获取锁时是否发生了竞争
+type tryLocker interface {
+	sync.Locker
+	TryLock() bool
+}
+
+// Wrap 包装 l，通过返回的 Locker 获取锁都会被记录为写锁
+// l 实现了 TryLock 时（例如 *sync.Mutex），竞争通过 TryLock 是否失败来判断；
+// 否则等待时间超过 1µs 就认为发生了竞争。
+// 返回的 Locker 只知道通过它获取锁的持有者，同一个 RWMutex 的读写两端使用 NewRWMutex。
+func (p *Profile) Wrap(l sync.Locker) sync.Locker {
+	return &locker{p: p, l: l}
+}
+
+// WrapReader 包装共享的锁，例如 RWMutex.RLocker()，通过返回的 Locker 获取锁都会被记录为读锁
+func (p *Profile) WrapReader(l sync.Locker) sync.Locker {
+	return &locker{p: p, l: l, read: true}
+}
+
+type locker struct {
+	p    *Profile
+	l    sync.Locker
+	read bool
+
+	holder   atomic.Pointer[stack] // 最近一次获取锁的调用栈
+	lockedAt time.Time             // 只有持有写锁的一方会修改
+}
+
+func (l *locker) Lock() {
+	start := time.Now()
+	holder := l.holder.Load()
+	var contended bool
+	if tl, ok := l.l.(tryLocker); ok {
+		if contended = !tl.TryLock(); contended {
+			holder = l.holder.Load()
+			l.l.Lock()
+		}
+	} else {
+		l.l.Lock()
+	}
+	now := time.Now()
+	wait := now.Sub(start)
+	if _, ok := l.l.(tryLocker); !ok {
+		contended = wait > time.Microsecond
+	}
+
+	if l.read {
+		l.p.enterReader()
+	} else {
+		l.lockedAt = now
+	}
+	l.holder.Store(callers())
+	l.p.acquired(l.read, contended, wait, holder)
+}
+
+func (l *locker) Unlock() {
+	if l.read {
+		l.p.leaveReader()
+	} else {
+		l.p.released(time.Since(l.lockedAt))
+	}
+	l.l.Unlock()
+}
+
+// RWMutex 记录竞争情况的读写锁，可以替换 sync.RWMutex
+type RWMutex struct {
+	p        *Profile
+	rw       sync.RWMutex
+	holder   atomic.Pointer[stack] // 最近一次获取读锁或者写锁的调用栈
+	lockedAt time.Time
+}
+
+// NewRWMutex 返回由 p 记录的 RWMutex
+func (p *Profile) NewRWMutex() *RWMutex {
+	return &RWMutex{p: p}
+}
+
+// Lock 获取写锁
+func (m *RWMutex) Lock() {
+	start := time.Now()
+	var holder *stack
+	contended := !m.rw.TryLock()
+	if contended {
+		holder = m.holder.Load()
+		m.rw.Lock()
+	}
+	m.lockedAt = time.Now()
+	m.holder.Store(callers())
+	m.p.acquired(false, contended, m.lockedAt.Sub(start), holder)
+}
+
+// Unlock 释放写锁
+func (m *RWMutex) Unlock() {
+	m.p.released(time.Since(m.lockedAt))
+	m.rw.Unlock()
+}
+
+// RLock 获取读锁
+func (m *RWMutex) RLock() {
+	start := time.Now()
+	var holder *stack
+	contended := !m.rw.TryRLock()
+	if contended {
+		holder = m.holder.Load()
+		m.rw.RLock()
+	}
+	m.p.enterReader()
+	m.holder.Store(callers())
+	m.p.acquired(true, contended, time.Since(start), holder)
+}
+
+// RUnlock 释放读锁
+func (m *RWMutex) RUnlock() {
+	m.p.leaveReader()
+	m.rw.RUnlock()
+}
+
+// RLocker 返回通过 RLock 和 RUnlock 实现的 sync.Locker
+func (m *RWMutex) RLocker() sync.Locker {
+	return rlocker{m}
+}
+
+type rlocker struct{ m *RWMutex }
+
+func (r rlocker) Lock()   { r.m.RLock() }
+func (r rlocker) Unlock() { r.m.RUnlock() }
+
+// enterReader 记录同时持有读锁的数量和它的最大值
+func (p *Profile) enterReader() {
+	readers := atomic.AddInt64(&p.readers, 1)
+	for {
+		peak := atomic.LoadInt64(&p.maxReaders)
+		if readers <= peak || atomic.CompareAndSwapInt64(&p.maxReaders, peak, readers) {
+			return
+		}
+	}
+}
+
+func (p *Profile) leaveReader() {
+	atomic.AddInt64(&p.readers, -1)
+}
+
+// acquired 记录一次获取，竞争时按照 sampleEvery 采样，把等待时间记在 holder 上
+// holder 是发现竞争时最近一次获取锁的调用栈，也就是造成等待的持有者；
+// 等待期间锁可能已经换了持有者，所以这只是近似。holder 未知时（锁被包装之外的代码持有）不记录调用栈。
+func (p *Profile) acquired(read, contended bool, wait time.Duration, holder *stack) {
+	sampled := contended && atomic.AddInt64(&p.contended, 1)%p.sampleEvery == 0 && holder != nil
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if read {
+		p.readAcquired++
+		p.readWait.observe(wait)
+		if contended {
+			p.readContended++
+		}
+	} else {
+		p.writeAcquired++
+		p.writeWait.observe(wait)
+		if contended {
+			p.writeContended++
+		}
+	}
+	if sampled {
+		s := p.stacks[*holder]
+		if s == nil {
+			s = &stackSample{}
+			p.stacks[*holder] = s
+		}
+		s.count += p.sampleEvery // 按采样率放大，估计真实的次数
+		s.wait += time.Duration(p.sampleEvery) * wait
+	}
+}
+
+// released 记录一次写锁的持有时间
+func (p *Profile) released(hold time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.writeHold.observe(hold)
+}
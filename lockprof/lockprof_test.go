@@ -0,0 +1,194 @@
+package lockprof
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// contend 让 workers 个 goroutine 各自获取 l 共 n 次，每次持有 hold
+func contend(l sync.Locker, workers, n int, hold time.Duration) {
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for j := 0; j < n; j++ {
+				l.Lock()
+				time.Sleep(hold)
+				l.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+/*
+go test ./lockprof -v -count=1 -run TestWrap
+*/
+func TestWrap(t *testing.T) {
+	p := NewProfile("mutex", Options{})
+	contend(p.Wrap(&sync.Mutex{}), 4, 10, 100*time.Microsecond)
+
+	s := p.Snapshot()
+	if s.Writes.Acquired != 40 || s.Reads.Acquired != 0 {
+		t.Fatalf("got %d writes %d reads, want 40 writes", s.Writes.Acquired, s.Reads.Acquired)
+	}
+	if s.Writes.Contended == 0 || len(s.Stacks) == 0 {
+		t.Fatalf("4 goroutines did not contend: %+v", s.Writes)
+	}
+	if s.Writes.Wait.Count != 40 || s.Writes.Hold.Count != 40 || s.Writes.Hold.Mean() < 100*time.Microsecond {
+		t.Fatalf("unexpected histograms: wait %+v hold %+v", s.Writes.Wait, s.Writes.Hold)
+	}
+	if !strings.Contains(strings.Join(s.Stacks[0].Frames, "\n"), "lockprof.contend") {
+		t.Fatalf("sampled stack does not show the caller:\n%s", strings.Join(s.Stacks[0].Frames, "\n"))
+	}
+}
+
+// holdLock 和 waitLock 分别是持有者和等待者，调用栈中可以通过函数名区分它们
+func holdLock(l sync.Locker, locked chan<- struct{}, hold time.Duration) {
+	l.Lock()
+	close(locked)
+	time.Sleep(hold)
+	l.Unlock()
+}
+
+func waitLock(l sync.Locker) {
+	l.Lock()
+	l.Unlock()
+}
+
+/*
+go test ./lockprof -v -count=1 -run TestHolderStack
+*/
+// TestHolderStack 竞争记在持有者的调用栈上，而不是等待者的
+func TestHolderStack(t *testing.T) {
+	for name, newLocker := range map[string]func(p *Profile) sync.Locker{
+		"Wrap":    func(p *Profile) sync.Locker { return p.Wrap(&sync.Mutex{}) },
+		"RWMutex": func(p *Profile) sync.Locker { return p.NewRWMutex() },
+	} {
+		t.Run(name, func(t *testing.T) {
+			p := NewProfile(name, Options{})
+			l := newLocker(p)
+			locked := make(chan struct{})
+			go holdLock(l, locked, 10*time.Millisecond)
+			<-locked
+			waitLock(l)
+
+			s := p.Snapshot()
+			if len(s.Stacks) != 1 {
+				t.Fatalf("got %d stacks, want 1", len(s.Stacks))
+			}
+			frames := strings.Join(s.Stacks[0].Frames, "\n")
+			if !strings.Contains(frames, "lockprof.holdLock") || strings.Contains(frames, "lockprof.waitLock") {
+				t.Fatalf("stack is not the holder's:\n%s", frames)
+			}
+			if s.Stacks[0].Wait < 5*time.Millisecond {
+				t.Fatalf("wait %v, want about 10ms", s.Stacks[0].Wait)
+			}
+		})
+	}
+}
+
+/*
+go test ./lockprof -v -count=1 -run TestRWMutex
+*/
+// TestRWMutex 读者可以同时持有读锁，写者和读者互相竞争
+func TestRWMutex(t *testing.T) {
+	p := NewProfile("rwmutex", Options{SampleEvery: 2})
+	m := p.NewRWMutex()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		contend(m.RLocker(), 8, 5, time.Millisecond)
+	}()
+	go func() {
+		defer wg.Done()
+		contend(m, 1, 5, time.Millisecond)
+	}()
+	wg.Wait()
+
+	s := p.Snapshot()
+	if s.Reads.Acquired != 40 || s.Writes.Acquired != 5 {
+		t.Fatalf("got %d reads %d writes, want 40 and 5", s.Reads.Acquired, s.Writes.Acquired)
+	}
+	if s.MaxReaders < 2 || s.MaxReaders > 8 {
+		t.Fatalf("max readers %d, want concurrent readers", s.MaxReaders)
+	}
+	for _, ss := range s.Stacks {
+		if ss.Count%2 != 0 {
+			t.Fatalf("sample count %d not scaled by SampleEvery", ss.Count)
+		}
+	}
+}
+
+/*
+go test ./lockprof -v -count=1 -run TestHistogram
+*/
+func TestHistogram(t *testing.T) {
+	h := newHistogram([]time.Duration{time.Millisecond, time.Second})
+	for _, d := range []time.Duration{0, time.Millisecond, 2 * time.Millisecond, time.Minute} {
+		h.observe(d)
+	}
+	if want := []int64{2, 1, 1}; !equal(h.Counts, want) || h.Max != time.Minute || h.Count != 4 {
+		t.Fatalf("got %+v, want counts %v", h, want)
+	}
+}
+
+func equal(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+go test ./lockprof -v -count=1 -run TestWrite
+*/
+func TestWrite(t *testing.T) {
+	p := NewProfile("mutex", Options{})
+	contend(p.Wrap(&sync.Mutex{}), 4, 10, 100*time.Microsecond)
+
+	var buf bytes.Buffer
+	if err := p.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var s Snapshot
+	if err := json.Unmarshal(buf.Bytes(), &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "mutex" || s.Writes.Acquired != 40 {
+		t.Fatalf("decoded %+v", s)
+	}
+
+	buf.Reset()
+	if err := p.WritePprof(&buf); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 字符串表中应该有样本的类型和被采样的函数
+	for _, want := range []string{"contentions", "delay", "nanoseconds", "lockprof.contend"} {
+		if !bytes.Contains(raw, []byte(want)) {
+			t.Fatalf("pprof profile does not contain %q", want)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package lockprof
+
+import (
+	"compress/gzip"
+	"io"
+	"runtime"
+)
+
+// WritePprof 将采样的调用栈以 pprof 格式（gzip 压缩的 profile.proto）写入 w
+// 和 runtime 的 mutex profile 一样，每个样本有两个值：竞争次数和等待的纳秒数，
+// 可以使用 go tool pprof 分析，例如 go tool pprof -top lock.pb.gz。
+func (p *Profile) WritePprof(w io.Writer) error {
+	s := p.Snapshot()
+	b := newProfileBuilder()
+
+	var prof protoBuffer
+	for _, st := range [][2]string{{"contentions", "count"}, {"delay", "nanoseconds"}} {
+		var vt protoBuffer
+		vt.int64(1, b.str(st[0]))
+		vt.int64(2, b.str(st[1]))
+		prof.message(1, vt)
+	}
+	for _, ss := range s.Stacks {
+		var sample protoBuffer
+		ids := make([]uint64, len(ss.pcs))
+		for i, pc := range ss.pcs {
+			ids[i] = b.location(pc)
+		}
+		sample.packedUint64(1, ids)
+		sample.packedInt64(2, []int64{ss.Count, int64(ss.Wait)})
+		prof.message(2, sample)
+	}
+	for _, loc := range b.locations {
+		prof.message(4, loc)
+	}
+	for _, fn := range b.functions {
+		prof.message(5, fn)
+	}
+	// 字符串表必须在最后写入，前面的消息可能还会添加新的字符串
+	var periodType protoBuffer
+	periodType.int64(1, b.str("contentions"))
+	periodType.int64(2, b.str("count"))
+	for _, str := range b.strings {
+		prof.string(6, str)
+	}
+	prof.int64(9, p.start.UnixNano())
+	prof.int64(10, int64(s.Duration))
+	prof.message(11, periodType)
+	prof.int64(12, s.SampleEvery)
+
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(prof); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// profileBuilder 为 pprof 分配字符串、函数和位置的编号
+type profileBuilder struct {
+	strings     []string
+	stringIndex map[string]int64
+	functions   []protoBuffer
+	funcIndex   map[string]uint64
+	locations   []protoBuffer
+	locIndex    map[uintptr]uint64
+}
+
+func newProfileBuilder() *profileBuilder {
+	return &profileBuilder{
+		strings:     []string{""}, // 第 0 个字符串必须为空
+		stringIndex: map[string]int64{"": 0},
+		funcIndex:   make(map[string]uint64),
+		locIndex:    make(map[uintptr]uint64),
+	}
+}
+
+func (b *profileBuilder) str(s string) int64 {
+	if i, ok := b.stringIndex[s]; ok {
+		return i
+	}
+	i := int64(len(b.strings))
+	b.strings = append(b.strings, s)
+	b.stringIndex[s] = i
+	return i
+}
+
+func (b *profileBuilder) function(name, file string) uint64 {
+	if id, ok := b.funcIndex[name]; ok {
+		return id
+	}
+	id := uint64(len(b.functions) + 1)
+	var fn protoBuffer
+	fn.uint64(1, id)
+	fn.int64(2, b.str(name))
+	fn.int64(3, b.str(name))
+	fn.int64(4, b.str(file))
+	b.functions = append(b.functions, fn)
+	b.funcIndex[name] = id
+	return id
+}
+
+// location 一个 pc 可能对应多个内联的函数，它们都是同一个位置的 line
+func (b *profileBuilder) location(pc uintptr) uint64 {
+	if id, ok := b.locIndex[pc]; ok {
+		return id
+	}
+	id := uint64(len(b.locations) + 1)
+	var loc protoBuffer
+	loc.uint64(1, id)
+	loc.uint64(3, uint64(pc))
+	frames := runtime.CallersFrames([]uintptr{pc})
+	for {
+		f, more := frames.Next()
+		var line protoBuffer
+		line.uint64(1, b.function(f.Function, f.File))
+		line.int64(2, int64(f.Line))
+		loc.message(4, line)
+		if !more {
+			break
+		}
+	}
+	b.locations = append(b.locations, loc)
+	b.locIndex[pc] = id
+	return id
+}
+
+// protoBuffer 最小的 protobuf 编码，只支持 profile.proto 用到的类型
+type protoBuffer []byte
+
+func (p *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		*p = append(*p, byte(x)|0x80)
+		x >>= 7
+	}
+	*p = append(*p, byte(x))
+}
+
+func (p *protoBuffer) key(field int, wireType uint64) {
+	p.varint(uint64(field)<<3 | wireType)
+}
+
+func (p *protoBuffer) uint64(field int, x uint64) {
+	if x == 0 {
+		return
+	}
+	p.key(field, 0)
+	p.varint(x)
+}
+
+func (p *protoBuffer) int64(field int, x int64) {
+	p.uint64(field, uint64(x))
+}
+
+func (p *protoBuffer) bytes(field int, b []byte) {
+	p.key(field, 2)
+	p.varint(uint64(len(b)))
+	*p = append(*p, b...)
+}
+
+func (p *protoBuffer) string(field int, s string) {
+	p.bytes(field, []byte(s))
+}
+
+func (p *protoBuffer) message(field int, m protoBuffer) {
+	p.bytes(field, m)
+}
+
+func (p *protoBuffer) packedUint64(field int, xs []uint64) {
+	var packed protoBuffer
+	for _, x := range xs {
+		packed.varint(x)
+	}
+	p.bytes(field, packed)
+}
+
+func (p *protoBuffer) packedInt64(field int, xs []int64) {
+	var packed protoBuffer
+	for _, x := range xs {
+		packed.varint(uint64(x))
+	}
+	p.bytes(field, packed)
+}
@@ -0,0 +1,100 @@
+package lockprof
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// maxDepth 采样的调用栈的最大深度
+const maxDepth = 32
+
+type stackSample struct {
+	count int64
+	wait  time.Duration
+}
+
+// stack 获取锁的调用栈，末尾没有用到的部分为 0
+type stack [maxDepth]uintptr
+
+// callers 返回获取锁的调用栈，跳过 runtime.Callers 和 callers 自己，栈顶是 Lock 或者 RLock
+// 每次获取锁都会记录，持有者的调用栈要在发生竞争之前就准备好。
+func callers() *stack {
+	var s stack
+	runtime.Callers(2, s[:])
+	return &s
+}
+
+// Acquisitions 读锁或者写锁的统计
+type Acquisitions struct {
+	Acquired  int64      `json:"acquired"`
+	Contended int64      `json:"contended"` // 获取时锁已经被其他人持有的次数
+	Wait      Histogram  `json:"wait"`
+	Hold      *Histogram `json:"hold,omitempty"` // 只记录写锁的持有时间
+}
+
+// StackSample 一个持有者的调用栈造成的竞争
+// Frames 是持有者获取锁时的调用栈，而不是等待者的，和 runtime 的 mutex profile 一样指向造成等待的代码。
+type StackSample struct {
+	Count  int64         `json:"count"` // 按采样率放大后的竞争次数
+	Wait   time.Duration `json:"wait"`  // 按采样率放大后的等待时间
+	Frames []string      `json:"frames"`
+
+	pcs []uintptr
+}
+
+// Snapshot 某一时刻 Profile 的内容，可以直接编码为 JSON
+type Snapshot struct {
+	Name        string        `json:"name"`
+	Duration    time.Duration `json:"duration"`
+	SampleEvery int64         `json:"sample_every"`
+	Reads       Acquisitions  `json:"reads"`
+	Writes      Acquisitions  `json:"writes"`
+	MaxReaders  int64         `json:"max_readers"` // 同时持有读锁的最大数量
+	Stacks      []StackSample `json:"stacks"`      // 持有者的调用栈，按等待时间从长到短排序
+}
+
+// Snapshot 返回当前的统计
+func (p *Profile) Snapshot() Snapshot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	hold := p.writeHold.clone()
+	s := Snapshot{
+		Name:        p.name,
+		Duration:    time.Since(p.start),
+		SampleEvery: p.sampleEvery,
+		Reads:       Acquisitions{Acquired: p.readAcquired, Contended: p.readContended, Wait: p.readWait.clone()},
+		Writes:      Acquisitions{Acquired: p.writeAcquired, Contended: p.writeContended, Wait: p.writeWait.clone(), Hold: &hold},
+		MaxReaders:  atomic.LoadInt64(&p.maxReaders),
+	}
+	for holder, sample := range p.stacks {
+		pcs := append([]uintptr(nil), holder[:]...) // holder 在每次循环中被复用
+		for len(pcs) > 0 && pcs[len(pcs)-1] == 0 {
+			pcs = pcs[:len(pcs)-1]
+		}
+		ss := StackSample{Count: sample.count, Wait: sample.wait, pcs: pcs}
+		frames := runtime.CallersFrames(pcs)
+		for {
+			f, more := frames.Next()
+			ss.Frames = append(ss.Frames, fmt.Sprintf("%s %s:%d", f.Function, f.File, f.Line))
+			if !more {
+				break
+			}
+		}
+		s.Stacks = append(s.Stacks, ss)
+	}
+	sort.Slice(s.Stacks, func(i, j int) bool { return s.Stacks[i].Wait > s.Stacks[j].Wait })
+	return s
+}
+
+// WriteJSON 将当前的统计以 JSON 格式写入 w
+func (p *Profile) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p.Snapshot())
+}
@@ -0,0 +1,138 @@
+package locks
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"concurrency_in_go/internal/goid"
+)
+
+// HolderStats 一个持有者获取锁的统计
+type HolderStats struct {
+	Acquisitions int64         // 获取锁的次数
+	Wait         time.Duration // 等待锁的总时间
+	MaxWait      time.Duration // 最长的一次等待
+	Hold         time.Duration // 持有锁的总时间
+}
+
+// AvgWait 平均每次获取锁等待的时间
+func (s HolderStats) AvgWait() time.Duration {
+	if s.Acquisitions == 0 {
+		return 0
+	}
+	return s.Wait / time.Duration(s.Acquisitions)
+}
+
+// AvgHold 平均每次持有锁的时间
+func (s HolderStats) AvgHold() time.Duration {
+	if s.Acquisitions == 0 {
+		return 0
+	}
+	return s.Hold / time.Duration(s.Acquisitions)
+}
+
+// Metered 记录每个持有者等待和持有锁的时间的 sync.Locker 包装
+// 直接调用 Metered 的 Lock 和 Unlock 时，持有者是当前的 goroutine；
+// 使用 For 返回的 Locker 时，持有者是给定的名字，便于比较不同角色的 worker。
+type Metered struct {
+	l sync.Locker
+
+	mu       sync.Mutex
+	stats    map[string]*HolderStats
+	lockedAt time.Time // 锁被获取的时刻，只有持有锁的一方会修改
+	holder   string
+}
+
+var _ sync.Locker = (*Metered)(nil)
+
+// NewMetered 包装 l
+func NewMetered(l sync.Locker) *Metered {
+	return &Metered{l: l, stats: make(map[string]*HolderStats)}
+}
+
+// Lock 以当前 goroutine 的身份获取锁
+func (m *Metered) Lock() {
+	m.lock("goroutine " + strconv.FormatInt(goid.Get(), 10))
+}
+
+// Unlock 释放锁
+func (m *Metered) Unlock() {
+	m.unlock()
+}
+
+// For 返回以 name 的身份获取锁的 Locker，它们共享同一个底层的锁
+func (m *Metered) For(name string) sync.Locker {
+	return &namedLocker{m: m, name: name}
+}
+
+// Stats 返回每个持有者的统计
+func (m *Metered) Stats() map[string]HolderStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := make(map[string]HolderStats, len(m.stats))
+	for name, s := range m.stats {
+		stats[name] = *s
+	}
+	return stats
+}
+
+// Report 返回按持有者名字排序的统计表格
+func (m *Metered) Report() string {
+	stats := m.Stats()
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 1, 2, ' ', 0)
+	fmt.Fprintln(w, "holder\tacquisitions\tavg wait\tmax wait\tavg hold\ttotal hold")
+	for _, name := range names {
+		s := stats[name]
+		fmt.Fprintf(w, "%s\t%d\t%v\t%v\t%v\t%v\n", name, s.Acquisitions, s.AvgWait(), s.MaxWait, s.AvgHold(), s.Hold)
+	}
+	w.Flush()
+	return b.String()
+}
+
+func (m *Metered) lock(name string) {
+	start := time.Now()
+	m.l.Lock()
+	now := time.Now()
+	wait := now.Sub(start)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.stats[name]
+	if s == nil {
+		s = &HolderStats{}
+		m.stats[name] = s
+	}
+	s.Acquisitions++
+	s.Wait += wait
+	s.MaxWait = max(s.MaxWait, wait)
+	m.lockedAt, m.holder = now, name
+}
+
+func (m *Metered) unlock() {
+	m.mu.Lock()
+	if s := m.stats[m.holder]; s != nil {
+		s.Hold += time.Since(m.lockedAt)
+	}
+	m.mu.Unlock()
+	m.l.Unlock()
+}
+
+type namedLocker struct {
+	m    *Metered
+	name string
+}
+
+func (n *namedLocker) Lock()   { n.m.lock(n.name) }
+func (n *namedLocker) Unlock() { n.m.unlock() }
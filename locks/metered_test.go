@@ -0,0 +1,45 @@
+package locks
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+/*
+go test ./locks -v -count=1 -run TestMetered
+*/
+func TestMetered(t *testing.T) {
+	m := NewMetered(&sync.Mutex{})
+	holder, waiter := m.For("holder"), m.For("waiter")
+
+	holder.Lock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		waiter.Lock()
+		waiter.Unlock()
+	}()
+	time.Sleep(20 * time.Millisecond)
+	holder.Unlock()
+	<-done
+
+	stats := m.Stats()
+	if s := stats["holder"]; s.Acquisitions != 1 || s.Hold < 20*time.Millisecond {
+		t.Fatalf("holder: %+v, want 1 acquisition held for at least 20ms", s)
+	}
+	if s := stats["waiter"]; s.Acquisitions != 1 || s.MaxWait < 15*time.Millisecond || s.AvgWait() != s.Wait {
+		t.Fatalf("waiter: %+v, want 1 acquisition waiting about 20ms", s)
+	}
+
+	// 直接使用 Metered 时按 goroutine 统计
+	m.Lock()
+	m.Unlock()
+	report := m.Report()
+	for _, name := range []string{"holder", "waiter", "goroutine "} {
+		if !strings.Contains(report, name) {
+			t.Fatalf("report does not mention %q:\n%s", name, report)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// Package locks 第一章中死锁和饥饿问题的补救措施
+// sync.Mutex 的 Lock 会一直等待下去，持有锁的 goroutine 无法后退，
+// 这正是死锁的 Coffman 条件中的“没有抢占”。
+// Mutex 支持 TryLock 和 LockContext，等待超时或者被取消时可以放弃；
+// LockAll 按照固定的全局顺序获取多个锁，破坏“循环等待”条件。
+// TicketMutex 先来先服务，避免贪婪的 goroutine 让其他 goroutine 饥饿；
+// Metered 记录每个持有者等待和持有锁的时间，用来度量饥饿。
+package locks
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// nextID 为每个 Mutex 分配全局顺序
+var nextID uint64
+
+// Mutex 可以放弃等待的互斥锁，实现了 sync.Locker
+// 零值可以直接使用，使用之后不能复制。
+type Mutex struct {
+	once sync.Once
+	id   uint64
+	sem  chan struct{} // 缓冲区为 1，持有锁就是向 sem 写入一个值
+}
+
+func (m *Mutex) init() {
+	m.once.Do(func() {
+		m.id = atomic.AddUint64(&nextID, 1)
+		m.sem = make(chan struct{}, 1)
+	})
+}
+
+// Lock 获取锁，一直等待直到成功
+func (m *Mutex) Lock() {
+	m.init()
+	m.sem <- struct{}{}
+}
+
+// TryLock 不等待，锁已经被持有时立即返回 false
+func (m *Mutex) TryLock() bool {
+	m.init()
+	select {
+	case m.sem <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// LockContext 获取锁，ctx 取消或者超时时放弃并返回 ctx.Err()
+func (m *Mutex) LockContext(ctx context.Context) error {
+	m.init()
+	select {
+	case m.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// LockTimeout 在 timeout 内获取锁，超时返回 false
+func (m *Mutex) LockTimeout(timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return m.LockContext(ctx) == nil
+}
+
+// Unlock 释放锁，锁没有被持有时 panic
+func (m *Mutex) Unlock() {
+	m.init()
+	select {
+	case <-m.sem:
+	default:
+		panic("locks: unlock of unlocked mutex")
+	}
+}
+
+// LockAll 按照全局顺序获取 mutexes 中的所有锁，返回释放它们的函数
+// 无论调用者以什么顺序传入，同一组锁总是以相同的顺序获取，所以不会形成循环等待。
+// 重复的锁只获取一次。ctx 取消时释放已经获取的锁并返回 ctx.Err()。
+func LockAll(ctx context.Context, mutexes ...*Mutex) (unlock func(), err error) {
+	ordered := make([]*Mutex, 0, len(mutexes))
+	seen := make(map[*Mutex]bool, len(mutexes))
+	for _, m := range mutexes {
+		if !seen[m] {
+			seen[m] = true
+			m.init()
+			ordered = append(ordered, m)
+		}
+	}
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i].id < ordered[j].id })
+
+	unlockAll := func(held []*Mutex) {
+		for i := len(held) - 1; i >= 0; i-- {
+			held[i].Unlock()
+		}
+	}
+	for i, m := range ordered {
+		if err := m.LockContext(ctx); err != nil {
+			unlockAll(ordered[:i])
+			return nil, err
+		}
+	}
+	return func() { unlockAll(ordered) }, nil
+}
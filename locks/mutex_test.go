@@ -0,0 +1,118 @@
+package locks
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+/*
+go test ./locks -v -count=1 -run TestTryLock
+*/
+func TestTryLock(t *testing.T) {
+	var m Mutex
+	if !m.TryLock() {
+		t.Fatal("TryLock failed on an unlocked mutex")
+	}
+	if m.TryLock() {
+		t.Fatal("TryLock succeeded on a locked mutex")
+	}
+	m.Unlock()
+	if !m.TryLock() {
+		t.Fatal("TryLock failed after Unlock")
+	}
+}
+
+/*
+go test ./locks -v -count=1 -run TestLockContext
+*/
+func TestLockContext(t *testing.T) {
+	var m Mutex
+	m.Lock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := m.LockContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want DeadlineExceeded", err)
+	}
+	if m.LockTimeout(10 * time.Millisecond) {
+		t.Fatal("LockTimeout succeeded on a locked mutex")
+	}
+
+	time.AfterFunc(10*time.Millisecond, m.Unlock)
+	if err := m.LockContext(context.Background()); err != nil {
+		t.Fatalf("got %v after the holder unlocked", err)
+	}
+}
+
+/*
+go test ./locks -v -count=1 -run TestUnlockUnlocked
+*/
+func TestUnlockUnlocked(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Unlock of an unlocked mutex did not panic")
+		}
+	}()
+	var m Mutex
+	m.Unlock()
+}
+
+/*
+go test ./locks -v -count=1 -run TestLockAll
+*/
+// TestLockAll 两组 goroutine 以相反的顺序传入同样的锁，也不会死锁
+func TestLockAll(t *testing.T) {
+	var a, b, c Mutex
+	counter := 0
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			unlock, err := LockAll(context.Background(), &a, &b, &c)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer unlock()
+			counter++
+		}()
+		go func() {
+			defer wg.Done()
+			unlock, err := LockAll(context.Background(), &c, &b, &a, &c)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer unlock()
+			counter++
+		}()
+	}
+	wg.Wait()
+	if counter != 200 {
+		t.Fatalf("counter %d, want 200", counter)
+	}
+}
+
+/*
+go test ./locks -v -count=1 -run TestLockAllCanceled
+*/
+// TestLockAllCanceled 放弃时释放已经获取的锁
+func TestLockAllCanceled(t *testing.T) {
+	var a, b Mutex
+	a.Lock() // 第一次使用时分配顺序，a 排在 b 的前面
+	a.Unlock()
+	b.Lock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := LockAll(ctx, &a, &b); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want DeadlineExceeded", err)
+	}
+	if !a.TryLock() {
+		t.Fatal("a is still held after LockAll gave up")
+	}
+}
@@ -0,0 +1,47 @@
+package locks
+
+import "sync"
+
+// TicketMutex 先来先服务的公平互斥锁，实现了 sync.Locker
+// 每个等待的 goroutine 按到达的顺序取一张票，Unlock 直接把锁交给排在最前面的票，
+// 刚刚释放锁的 goroutine 即使马上再次 Lock，也只能排到队尾，所以贪婪的 goroutine 无法让其他 goroutine 饥饿。
+// 代价是每次交接都需要唤醒另一个 goroutine，吞吐量低于 sync.Mutex。
+// 零值可以直接使用。
+type TicketMutex struct {
+	mu      sync.Mutex
+	locked  bool
+	waiters []chan struct{} // 按取票顺序排列，关闭 channel 表示轮到这张票
+}
+
+var _ sync.Locker = (*TicketMutex)(nil)
+
+// Lock 取票并等待轮到自己
+func (m *TicketMutex) Lock() {
+	m.mu.Lock()
+	if !m.locked {
+		m.locked = true
+		m.mu.Unlock()
+		return
+	}
+	ticket := make(chan struct{})
+	m.waiters = append(m.waiters, ticket)
+	m.mu.Unlock()
+	<-ticket // 锁由 Unlock 直接交给我们，locked 一直为 true
+}
+
+// Unlock 把锁交给下一张票，没有人等待时释放锁
+func (m *TicketMutex) Unlock() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.locked {
+		panic("locks: unlock of unlocked TicketMutex")
+	}
+	if len(m.waiters) == 0 {
+		m.locked = false
+		return
+	}
+	next := m.waiters[0]
+	m.waiters[0] = nil
+	m.waiters = m.waiters[1:]
+	close(next)
+}
@@ -0,0 +1,84 @@
+package locks
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitQueued 等待 m 的队列中有 n 张票
+func waitQueued(t *testing.T, m *TicketMutex, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		m.mu.Lock()
+		queued := len(m.waiters)
+		m.mu.Unlock()
+		if queued == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d waiters queued, want %d", queued, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+/*
+go test ./locks -v -count=1 -run TestTicketMutexFIFO
+*/
+// TestTicketMutexFIFO 锁按照等待的顺序交给等待者
+func TestTicketMutexFIFO(t *testing.T) {
+	var m TicketMutex
+	m.Lock()
+
+	var mu sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			m.Lock()
+			defer m.Unlock()
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, i)
+		}(i)
+		waitQueued(t, &m, i+1)
+	}
+
+	m.Unlock()
+	wg.Wait()
+	if !reflect.DeepEqual(order, []int{0, 1, 2, 3, 4}) {
+		t.Fatalf("got order %v, want FIFO", order)
+	}
+}
+
+/*
+go test ./locks -v -count=1 -run TestTicketMutexRelock
+*/
+// TestTicketMutexRelock 刚释放锁的 goroutine 再次 Lock 时排在已经等待的 goroutine 之后
+func TestTicketMutexRelock(t *testing.T) {
+	var m TicketMutex
+	m.Lock()
+
+	acquired := make(chan struct{})
+	go func() {
+		m.Lock()
+		close(acquired)
+		time.Sleep(10 * time.Millisecond)
+		m.Unlock()
+	}()
+	waitQueued(t, &m, 1)
+
+	m.Unlock()
+	m.Lock()
+	select {
+	case <-acquired:
+	default:
+		t.Fatal("relocked before the waiting goroutine")
+	}
+	m.Unlock()
+}
@@ -0,0 +1,92 @@
+package pipeline
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Indexed 带有来源 stream 下标的值
+// 下标是内部 stream 在 chanStream 中出现的顺序，从 0 开始。
+type Indexed[T any] struct {
+	Stream int
+	Value  T
+}
+
+// StreamError 内部 stream 产生的错误
+type StreamError struct {
+	Stream int
+	Err    error
+}
+
+func (e *StreamError) Error() string {
+	return fmt.Sprintf("pipeline: stream %d: %v", e.Stream, e.Err)
+}
+
+func (e *StreamError) Unwrap() error {
+	return e.Err
+}
+
+// BridgeOptions BridgeWith 的配置
+type BridgeOptions struct {
+	// Concurrent 为 false 时按顺序读完一个内部 stream 再读下一个，
+	// 所有值按照 stream 的顺序发送；为 true 时同时读取所有内部 stream，
+	// 只保证同一个 stream 中值的顺序。
+	Concurrent bool
+}
+
+// BridgeWith 将 Result 流的流拆解为一个带下标的值的流和一个错误流
+// 内部 stream 中 Err 不为 nil 的 Result 会被包装为 *StreamError 发送到错误流，
+// 之后继续读取该 stream。两个返回的 channel 在所有内部 stream 读完后关闭，
+// 调用方需要同时读取这两个 channel，否则 bridge 会阻塞。
+// done 关闭时 bridge 直接退出：已经从内部 stream 读出但还没有被消费者接收的值会被丢弃，
+// 不会发送到错误流；需要知道哪些值没有被处理时，由消费者根据收到的值自己判断。
+func BridgeWith[T any](
+	done <-chan struct{},
+	chanStream <-chan (<-chan Result[T]),
+	opts BridgeOptions,
+) (<-chan Indexed[T], <-chan error) {
+	valStream := make(chan Indexed[T])
+	errStream := make(chan error)
+
+	drain := func(index int, stream <-chan Result[T]) {
+		for r := range OrDone(done, stream) {
+			if r.Err != nil {
+				select {
+				case errStream <- &StreamError{Stream: index, Err: r.Err}:
+				case <-done:
+					return
+				}
+				continue
+			}
+			select {
+			case valStream <- Indexed[T]{Stream: index, Value: r.Value}:
+			case <-done:
+				return
+			}
+		}
+	}
+
+	go func() {
+		var wg sync.WaitGroup
+		defer func() {
+			wg.Wait()
+			close(valStream)
+			close(errStream)
+		}()
+
+		index := 0
+		for stream := range OrDone(done, chanStream) {
+			if opts.Concurrent {
+				wg.Add(1)
+				go func(index int, stream <-chan Result[T]) {
+					defer wg.Done()
+					drain(index, stream)
+				}(index, stream)
+			} else {
+				drain(index, stream)
+			}
+			index++
+		}
+	}()
+	return valStream, errStream
+}
@@ -0,0 +1,138 @@
+package pipeline
+
+import (
+	"errors"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// resultStreams 第 i 个内部 stream 依次发送 values[i] 中的值，负数表示一个错误
+func resultStreams(done <-chan struct{}, values ...[]int) <-chan (<-chan Result[int]) {
+	errNegative := errors.New("negative value")
+	chanStream := make(chan (<-chan Result[int]))
+	go func() {
+		defer close(chanStream)
+		for _, vs := range values {
+			results := make([]Result[int], len(vs))
+			for i, v := range vs {
+				results[i] = Result[int]{Value: v}
+				if v < 0 {
+					results[i] = Result[int]{Err: errNegative}
+				}
+			}
+			select {
+			case <-done:
+				return
+			case chanStream <- Generator(done, results...):
+			}
+		}
+	}()
+	return chanStream
+}
+
+// drainBridge 同时读取值和错误，直到两个 channel 都关闭
+func drainBridge[T any](vals <-chan Indexed[T], errs <-chan error) ([]Indexed[T], []error) {
+	var gotVals []Indexed[T]
+	var gotErrs []error
+	for vals != nil || errs != nil {
+		select {
+		case v, ok := <-vals:
+			if !ok {
+				vals = nil
+				continue
+			}
+			gotVals = append(gotVals, v)
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			gotErrs = append(gotErrs, err)
+		}
+	}
+	return gotVals, gotErrs
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestBridgeWithSequential
+*/
+func TestBridgeWithSequential(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	vals, errs := drainBridge(BridgeWith(done, resultStreams(done, []int{1, 2}, []int{3, -1, 4}, []int{5}), BridgeOptions{}))
+	want := []Indexed[int]{{0, 1}, {0, 2}, {1, 3}, {1, 4}, {2, 5}}
+	if !reflect.DeepEqual(vals, want) {
+		t.Fatalf("got %v, want %v", vals, want)
+	}
+
+	var streamErr *StreamError
+	if len(errs) != 1 || !errors.As(errs[0], &streamErr) || streamErr.Stream != 1 {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestBridgeWithConcurrent
+*/
+func TestBridgeWithConcurrent(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	streams := [][]int{{1, 2, 3}, {4, -1, 5, 6}, {7, 8}, {-1, -1}}
+	vals, errs := drainBridge(BridgeWith(done, resultStreams(done, streams...), BridgeOptions{Concurrent: true}))
+
+	perStream := make(map[int][]int)
+	for _, v := range vals {
+		perStream[v.Stream] = append(perStream[v.Stream], v.Value)
+	}
+	want := map[int][]int{0: {1, 2, 3}, 1: {4, 5, 6}, 2: {7, 8}}
+	if !reflect.DeepEqual(perStream, want) {
+		t.Fatalf("got %v, want %v", perStream, want)
+	}
+	if len(errs) != 3 {
+		t.Fatalf("got %d errors, want 3: %v", len(errs), errs)
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestBridgeWithCancel
+*/
+// TestBridgeWithCancel 消费者不再读取时关闭 done，bridge 不能阻塞在发送上
+func TestBridgeWithCancel(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		before := runtime.NumGoroutine()
+		done := make(chan struct{})
+		chanStream := Repeat(done, Repeat(done, Result[int]{Value: 1}), Repeat(done, Result[int]{Value: 2}))
+		vals, errs := BridgeWith(done, chanStream, BridgeOptions{Concurrent: concurrent})
+		<-vals
+		close(done)
+		drainBridge(vals, errs)
+		checkNoLeak(t, before)
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestBridgeWithCancelDiscards
+*/
+// TestBridgeWithCancelDiscards done 关闭时已经从内部 stream 读出的值被丢弃，两个 channel 都不会收到它
+func TestBridgeWithCancelDiscards(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		done := make(chan struct{})
+		inner := make(chan Result[int])
+		chanStream := make(chan (<-chan Result[int]), 1)
+		chanStream <- inner
+		vals, errs := BridgeWith(done, chanStream, BridgeOptions{Concurrent: concurrent})
+
+		inner <- Result[int]{Value: 1} // bridge 已经读出这个值，正在等待消费者
+		close(done)
+		// 没有人读取值的流，bridge 只能选择 done 退出
+		for err := range errs {
+			t.Fatalf("concurrent %v: got error %v, want the value discarded silently", concurrent, err)
+		}
+		for v := range vals {
+			t.Fatalf("concurrent %v: got %v after done, want it discarded", concurrent, v)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package pipeline
+
+import (
+	"reflect"
+	"sync"
+)
+
+// LagPolicy 广播时某个订阅者的缓冲区已满（跟不上）时的处理策略
+type LagPolicy int
+
+const (
+	// BlockAll 等待跟不上的订阅者，所有订阅者都会收到每一个值，和 Tee 相同
+	BlockAll LagPolicy = iota
+	// DropLagging 跟不上的订阅者丢失这个值，其他订阅者不受影响
+	DropLagging
+	// DisconnectLagging 关闭跟不上的订阅者的 channel，之后不再向它发送
+	DisconnectLagging
+)
+
+// BroadcastStats 一个订阅者的计数器
+type BroadcastStats struct {
+	Sent         int64 // 发送给该订阅者的值的数量
+	Dropped      int64 // 该订阅者丢失的值的数量
+	Disconnected bool  // 该订阅者是否已经被断开
+}
+
+// Broadcast N 路的 tee，将每个值发送给所有的订阅者
+// 每个订阅者都有自己的缓冲区，缓冲区满时按照 LagPolicy 处理。
+type Broadcast[T any] struct {
+	outs   []chan T
+	policy LagPolicy
+
+	mu    sync.Mutex
+	stats []BroadcastStats
+}
+
+// NewBroadcast 将 valueStream 广播给 n 个订阅者，每个订阅者的缓冲区容量为 buffer
+func NewBroadcast[T any](done <-chan struct{}, valueStream <-chan T, n, buffer int, policy LagPolicy) *Broadcast[T] {
+	b := &Broadcast[T]{
+		outs:   make([]chan T, n),
+		policy: policy,
+		stats:  make([]BroadcastStats, n),
+	}
+	for i := range b.outs {
+		b.outs[i] = make(chan T, buffer)
+	}
+	go b.run(done, valueStream)
+	return b
+}
+
+// Outs 返回所有订阅者的 channel，下标和 Stats 中的下标对应
+func (b *Broadcast[T]) Outs() []<-chan T {
+	outs := make([]<-chan T, len(b.outs))
+	for i, out := range b.outs {
+		outs[i] = out
+	}
+	return outs
+}
+
+// Stats 返回每个订阅者计数器的快照
+func (b *Broadcast[T]) Stats() []BroadcastStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]BroadcastStats(nil), b.stats...)
+}
+
+func (b *Broadcast[T]) run(done <-chan struct{}, valueStream <-chan T) {
+	live := make([]chan T, len(b.outs)) // 被断开的订阅者置为 nil
+	copy(live, b.outs)
+	defer func() {
+		for _, out := range live {
+			if out != nil {
+				close(out)
+			}
+		}
+	}()
+
+	for val := range OrDone(done, valueStream) {
+		if b.policy == BlockAll {
+			if !b.sendAll(done, live, val) {
+				return
+			}
+			continue
+		}
+
+		for i, out := range live {
+			if out == nil {
+				continue
+			}
+			select {
+			case out <- val:
+				b.record(i, func(s *BroadcastStats) { s.Sent++ })
+			default:
+				if b.policy == DropLagging {
+					b.record(i, func(s *BroadcastStats) { s.Dropped++ })
+					continue
+				}
+				close(out)
+				live[i] = nil
+				b.record(i, func(s *BroadcastStats) { s.Dropped++; s.Disconnected = true })
+			}
+		}
+	}
+}
+
+// sendAll 将 val 发送给所有订阅者，先接收的订阅者不需要等待其他订阅者
+// done 关闭时返回 false。
+func (b *Broadcast[T]) sendAll(done <-chan struct{}, live []chan T, val T) bool {
+	send := reflect.ValueOf(&val).Elem() // 保留 T 的类型，即使 T 是值为 nil 的接口
+	cases := make([]reflect.SelectCase, 0, len(live)+1)
+	cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)})
+	for _, out := range live {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectSend, Chan: reflect.ValueOf(out), Send: send})
+	}
+
+	for remaining := len(live); remaining > 0; remaining-- {
+		chosen, _, _ := reflect.Select(cases)
+		if chosen == 0 {
+			return false
+		}
+		cases[chosen].Chan = reflect.Value{} // 已经发送过的订阅者不再参与 select
+		b.record(chosen-1, func(s *BroadcastStats) { s.Sent++ })
+	}
+	return true
+}
+
+func (b *Broadcast[T]) record(i int, update func(*BroadcastStats)) {
+	b.mu.Lock()
+	update(&b.stats[i])
+	b.mu.Unlock()
+}
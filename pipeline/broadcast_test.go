@@ -0,0 +1,107 @@
+package pipeline
+
+import (
+	"reflect"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+/*
+go test ./pipeline -v -count=1 -run TestBroadcastBlockAll
+*/
+func TestBroadcastBlockAll(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	b := NewBroadcast(done, Generator(done, 1, 2, 3, 4, 5), 3, 0, BlockAll)
+	got := make([][]int, 3)
+	var wg sync.WaitGroup
+	for i, out := range b.Outs() {
+		wg.Add(1)
+		go func(i int, out <-chan int) {
+			defer wg.Done()
+			got[i] = collect(out)
+		}(i, out)
+	}
+	wg.Wait()
+
+	want := []int{1, 2, 3, 4, 5}
+	for i := range got {
+		if !reflect.DeepEqual(got[i], want) {
+			t.Fatalf("subscriber %d: got %v, want %v", i, got[i], want)
+		}
+	}
+	for i, s := range b.Stats() {
+		if s.Sent != 5 || s.Dropped != 0 {
+			t.Fatalf("subscriber %d: unexpected stats %+v", i, s)
+		}
+	}
+}
+
+// feedLagging 逐个发送 1..n，每发送一个值就从 outs[0] 读取一个值，
+// outs[1] 在发送结束之前一直不读取，模拟跟不上的订阅者。
+func feedLagging(t *testing.T, policy LagPolicy, n int) (fast, slow []int, stats []BroadcastStats) {
+	t.Helper()
+	done := make(chan struct{})
+	defer close(done)
+
+	in := make(chan int)
+	b := NewBroadcast(done, in, 2, 2, policy)
+	outs := b.Outs()
+	for i := 1; i <= n; i++ {
+		in <- i
+		fast = append(fast, <-outs[0])
+	}
+	close(in)
+	fast = append(fast, collect(outs[0])...)
+	return fast, collect(outs[1]), b.Stats()
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestBroadcastDropLagging
+*/
+func TestBroadcastDropLagging(t *testing.T) {
+	fast, slow, stats := feedLagging(t, DropLagging, 10)
+	if want := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}; !reflect.DeepEqual(fast, want) {
+		t.Fatalf("fast subscriber: got %v, want %v", fast, want)
+	}
+	if want := []int{1, 2}; !reflect.DeepEqual(slow, want) {
+		t.Fatalf("slow subscriber: got %v, want %v", slow, want)
+	}
+	if stats[0].Dropped != 0 || stats[1].Dropped != 8 || stats[1].Disconnected {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestBroadcastDisconnectLagging
+*/
+func TestBroadcastDisconnectLagging(t *testing.T) {
+	fast, slow, stats := feedLagging(t, DisconnectLagging, 10)
+	if len(fast) != 10 {
+		t.Fatalf("fast subscriber: got %v", fast)
+	}
+	if want := []int{1, 2}; !reflect.DeepEqual(slow, want) {
+		t.Fatalf("slow subscriber: got %v, want %v", slow, want)
+	}
+	if stats[1].Sent != 2 || stats[1].Dropped != 1 || !stats[1].Disconnected {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestBroadcastCancel
+*/
+func TestBroadcastCancel(t *testing.T) {
+	before := runtime.NumGoroutine()
+	done := make(chan struct{})
+	b := NewBroadcast(done, Repeat(done, 1), 3, 1, BlockAll)
+	<-b.Outs()[0] // 其他订阅者不读取，广播阻塞
+	close(done)
+	for _, out := range b.Outs() {
+		for range out {
+		}
+	}
+	checkNoLeak(t, before)
+}
@@ -0,0 +1,55 @@
+package pipeline
+
+import "context"
+
+// 每个 stage 都可以传入 ctx.Done() 来取消，但是 channel 关闭之后，
+// 消费者无法区分 stream 是正常结束还是被取消了。
+// 下面接收 ctx 的版本和对应的 stage 行为相同，消费者在 stream 关闭之后通过 Err 或者 Collect 得知关闭的原因。
+
+// GeneratorCtx 接收 ctx 的 Generator
+func GeneratorCtx[T any](ctx context.Context, values ...T) <-chan T {
+	return Generator(ctx.Done(), values...)
+}
+
+// RepeatFnCtx 接收 ctx 的 RepeatFn
+func RepeatFnCtx[T any](ctx context.Context, fn func() T) <-chan T {
+	return RepeatFn(ctx.Done(), fn)
+}
+
+// TakeCtx 接收 ctx 的 Take
+func TakeCtx[T any](ctx context.Context, valueStream <-chan T, num int) <-chan T {
+	return Take(ctx.Done(), valueStream, num)
+}
+
+// MapCtx 接收 ctx 的 Map
+func MapCtx[T, U any](ctx context.Context, valueStream <-chan T, fn func(T) U) <-chan U {
+	return Map(ctx.Done(), valueStream, fn)
+}
+
+// BridgeCtx 接收 ctx 的 Bridge
+func BridgeCtx[T any](ctx context.Context, chanStream <-chan (<-chan T)) <-chan T {
+	return Bridge(ctx.Done(), chanStream)
+}
+
+// FanInCtx 接收 ctx 的 FanIn
+func FanInCtx[T any](ctx context.Context, channels ...<-chan T) <-chan T {
+	return FanIn(ctx.Done(), channels...)
+}
+
+// Err 在 stream 关闭之后调用，ctx 已经被取消时返回取消的原因 context.Cause(ctx)，
+// 说明 stream 可能被提前关闭，读到的值不完整；否则返回 nil，stream 是正常结束的。
+func Err(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return context.Cause(ctx)
+	}
+	return nil
+}
+
+// Collect 读取 stream 中所有的值，stream 关闭后返回读到的值和 Err(ctx)
+func Collect[T any](ctx context.Context, stream <-chan T) ([]T, error) {
+	var values []T
+	for v := range stream {
+		values = append(values, v)
+	}
+	return values, Err(ctx)
+}
@@ -0,0 +1,36 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+/*
+go test ./pipeline -v -count=1 -run TestCollect
+*/
+// TestCollect 正常结束的 stream 没有错误，被取消的 stream 返回取消的原因
+func TestCollect(t *testing.T) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	double := func(v int) int { return v * 2 }
+	got, err := Collect(ctx, MapCtx(ctx, GeneratorCtx(ctx, 1, 2, 3), double))
+	if err != nil || !reflect.DeepEqual(got, []int{2, 4, 6}) {
+		t.Fatalf("got %v, %v", got, err)
+	}
+
+	errStopped := errors.New("stopped")
+	n := 0
+	stream := TakeCtx(ctx, RepeatFnCtx(ctx, func() int {
+		if n++; n == 3 {
+			cancel(errStopped)
+		}
+		return n
+	}), 100)
+	got, err = Collect(ctx, stream)
+	if !errors.Is(err, errStopped) || len(got) >= 100 {
+		t.Fatalf("got %d values, %v, want fewer than 100 and %v", len(got), err, errStopped)
+	}
+}
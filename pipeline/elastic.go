@@ -0,0 +1,183 @@
+package pipeline
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ElasticConfig 弹性扇出的配置
+type ElasticConfig struct {
+	MinWorkers int           // worker 数量的下限，小于 1 时按 1 处理
+	MaxWorkers int           // worker 数量的上限，小于 MinWorkers 时按 MinWorkers 处理
+	QueueSize  int           // 输入队列的容量，小于 1 时按 MaxWorkers 处理
+	Interval   time.Duration // 调整 worker 数量的间隔，小于等于 0 时按 10ms 处理
+}
+
+// Elastic 根据输入队列的长度和每个值的处理耗时，动态调整 worker 数量的扇出 stage
+// 每个间隔内，根据利特尔法则 L = λW 估算需要的 worker 数量：
+// λ 是这段时间内值的到达率，W 是每个值的平均处理耗时。
+// 输入队列中积压的值多于 worker 数量时，再额外增加一个 worker；
+// 没有新的值到达并且队列为空时，逐个减少 worker。
+// 估算的数量少于当前数量时，每个间隔也最多减少一个 worker。
+// 结果的顺序不做保证。
+type Elastic[T, U any] struct {
+	cfg   ElasticConfig
+	fn    func(T) U
+	queue chan T
+	out   chan U
+
+	newTicker func(time.Duration) (<-chan time.Time, func()) // 测试中替换为手动的节拍
+
+	workers   int32 // 当前 worker 数量
+	arrived   int64 // 本间隔内到达的值的数量
+	processed int64 // 本间隔内处理完的值的数量
+	busy      int64 // 本间隔内处理值花费的总时间（纳秒）
+}
+
+// NewElastic 启动一个弹性扇出 stage，对 valueStream 中的每个值调用 fn
+func NewElastic[T, U any](done <-chan struct{}, valueStream <-chan T, cfg ElasticConfig, fn func(T) U) *Elastic[T, U] {
+	return newElastic(done, valueStream, cfg, fn, func(d time.Duration) (<-chan time.Time, func()) {
+		ticker := time.NewTicker(d)
+		return ticker.C, ticker.Stop
+	})
+}
+
+func newElastic[T, U any](
+	done <-chan struct{},
+	valueStream <-chan T,
+	cfg ElasticConfig,
+	fn func(T) U,
+	newTicker func(time.Duration) (<-chan time.Time, func()),
+) *Elastic[T, U] {
+	cfg.MinWorkers = max(cfg.MinWorkers, 1)
+	cfg.MaxWorkers = max(cfg.MaxWorkers, cfg.MinWorkers)
+	if cfg.QueueSize < 1 {
+		cfg.QueueSize = cfg.MaxWorkers
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 10 * time.Millisecond
+	}
+
+	e := &Elastic[T, U]{
+		cfg:       cfg,
+		fn:        fn,
+		queue:     make(chan T, cfg.QueueSize),
+		out:       make(chan U),
+		newTicker: newTicker,
+	}
+
+	// 将上游的值读入输入队列，全部读入后关闭 fed
+	fed := make(chan struct{})
+	go func() {
+		defer close(fed)
+		defer close(e.queue)
+		for v := range OrDone(done, valueStream) {
+			select {
+			case <-done:
+				return
+			case e.queue <- v:
+				atomic.AddInt64(&e.arrived, 1)
+			}
+		}
+	}()
+	go e.control(done, fed)
+	return e
+}
+
+// Out 返回结果 channel
+func (e *Elastic[T, U]) Out() <-chan U {
+	return e.out
+}
+
+// Workers 返回当前的 worker 数量
+func (e *Elastic[T, U]) Workers() int {
+	return int(atomic.LoadInt32(&e.workers))
+}
+
+// control 按照 Interval 调整 worker 数量，直到上游结束，所有 worker 退出后关闭 out
+func (e *Elastic[T, U]) control(done, fed <-chan struct{}) {
+	var wg sync.WaitGroup
+	var stops []chan struct{} // 每个 worker 的停止信号，后启动的先停止
+	defer func() {
+		wg.Wait()
+		close(e.out)
+	}()
+
+	scale := func(n int) {
+		for len(stops) < n {
+			stop := make(chan struct{})
+			stops = append(stops, stop)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				e.work(done, stop)
+			}()
+		}
+		for len(stops) > n {
+			close(stops[len(stops)-1])
+			stops = stops[:len(stops)-1]
+		}
+		atomic.StoreInt32(&e.workers, int32(n))
+	}
+	scale(e.cfg.MinWorkers)
+
+	ticks, stop := e.newTicker(e.cfg.Interval)
+	defer stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-fed: // 剩余的 worker 处理完输入队列后退出
+			return
+		case <-ticks:
+		}
+
+		current := len(stops)
+		arrived := atomic.SwapInt64(&e.arrived, 0)
+		processed := atomic.SwapInt64(&e.processed, 0)
+		busy := atomic.SwapInt64(&e.busy, 0)
+
+		// 没有新的值到达时 λ 为 0，估算没有意义，保持当前数量，由下面的规则决定是否减少
+		desired := current
+		if processed > 0 && arrived > 0 {
+			rate := float64(arrived) / e.cfg.Interval.Seconds()
+			latency := time.Duration(busy / processed).Seconds()
+			desired = int(math.Ceil(rate * latency))
+		}
+		switch depth := len(e.queue); {
+		case depth > current:
+			desired = max(desired, current+1)
+		case depth == 0 && arrived == 0:
+			desired = current - 1
+		}
+		desired = max(desired, current-1) // 每个间隔最多减少一个 worker
+		scale(min(max(desired, e.cfg.MinWorkers), e.cfg.MaxWorkers))
+	}
+}
+
+// work 从输入队列中读取值并处理，直到队列关闭、done 关闭或者收到停止信号
+func (e *Elastic[T, U]) work(done <-chan struct{}, stop <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-stop:
+			return
+		case v, ok := <-e.queue:
+			if !ok {
+				return
+			}
+			start := time.Now()
+			result := e.fn(v)
+			atomic.AddInt64(&e.busy, int64(time.Since(start)))
+			atomic.AddInt64(&e.processed, 1)
+			select {
+			case <-done:
+				return
+			case e.out <- result:
+			}
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package pipeline
+
+import (
+	"reflect"
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+)
+
+func slowSquare(v int) int {
+	time.Sleep(2 * time.Millisecond)
+	return v * v
+}
+
+// manualTicker 返回由测试手动发送节拍的 newTicker
+func manualTicker(ticks chan time.Time) func(time.Duration) (<-chan time.Time, func()) {
+	return func(time.Duration) (<-chan time.Time, func()) {
+		return ticks, func() {}
+	}
+}
+
+// eventually 等待 cond 成立，条件由测试控制，超时只用来避免测试挂起
+func eventually(t *testing.T, cond func() bool, format string, args ...interface{}) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf(format, args...)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestElastic
+*/
+// TestElastic worker 被阻塞时输入队列积压，每个节拍增加一个 worker 直到上限；放行之后所有的值都被处理
+func TestElastic(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	const n = 100
+	gate := make(chan struct{})
+	ticks := make(chan time.Time)
+	e := newElastic(done, Generator(done, seq(n)...), ElasticConfig{MinWorkers: 1, MaxWorkers: 8, QueueSize: 8},
+		func(v int) int {
+			<-gate
+			return v * v
+		}, manualTicker(ticks))
+
+	for workers := 1; workers <= 8; workers++ {
+		eventually(t, func() bool { return e.Workers() == workers && len(e.queue) == 8 },
+			"workers = %d, queue = %d, want %d workers and a full queue", e.Workers(), len(e.queue), workers)
+		ticks <- time.Now()
+	}
+	ticks <- time.Now() // 控制循环处理完上一个节拍之后才会接收这一个
+	if w := e.Workers(); w != 8 {
+		t.Fatalf("workers = %d, want the maximum 8", w)
+	}
+
+	close(gate)
+	var got []int
+	for v := range e.Out() {
+		got = append(got, v)
+	}
+	sort.Ints(got)
+	want := make([]int, n)
+	for i := range want {
+		want[i] = i * i
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestElasticScaleDown
+*/
+// TestElasticScaleDown 突发的输入结束后，没有新的值到达的每个节拍减少一个 worker，回落到下限
+func TestElasticScaleDown(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	in := make(chan int)
+	gate := make(chan struct{})
+	ticks := make(chan time.Time)
+	e := newElastic(done, in, ElasticConfig{MinWorkers: 2, MaxWorkers: 6, QueueSize: 6},
+		func(v int) int {
+			<-gate
+			return v * v
+		}, manualTicker(ticks))
+	results := make(chan int, 100)
+	go func() {
+		for v := range e.Out() {
+			results <- v
+		}
+	}()
+
+	go func() { // 突发的输入
+		for i := 0; i < 100; i++ {
+			in <- i
+		}
+	}()
+	for e.Workers() < 6 {
+		eventually(t, func() bool { return len(e.queue) == 6 }, "queue = %d, want full", len(e.queue))
+		ticks <- time.Now()
+	}
+
+	close(gate)
+	for i := 0; i < 100; i++ {
+		<-results
+	}
+	ticks <- time.Now() // 清空突发期间的到达计数
+	for w := 6; w > 2; w-- {
+		ticks <- time.Now()
+	}
+	ticks <- time.Now()
+	if w := e.Workers(); w != 2 {
+		t.Fatalf("workers = %d after the burst, want 2", w)
+	}
+	close(in)
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestElasticPausedBacklog
+*/
+// TestElasticPausedBacklog 上游暂停时队列中还有积压，没有新的值到达也不能一下子减少到下限
+func TestElasticPausedBacklog(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	in := make(chan int)
+	gate := make(chan struct{}) // 每发送一次放行一个值
+	ticks := make(chan time.Time)
+	e := newElastic(done, in, ElasticConfig{MinWorkers: 1, MaxWorkers: 4, QueueSize: 6},
+		func(v int) int {
+			<-gate
+			return v
+		}, manualTicker(ticks))
+	results := make(chan int, 10)
+	go func() {
+		for v := range e.Out() {
+			results <- v
+		}
+	}()
+
+	go func() { // 发送 10 个值之后暂停：4 个 worker 各持有一个，队列中积压 6 个
+		for i := 0; i < 10; i++ {
+			in <- i
+		}
+	}()
+	for e.Workers() < 4 {
+		eventually(t, func() bool { return len(e.queue) == 6 }, "queue = %d, want full", len(e.queue))
+		ticks <- time.Now()
+	}
+	eventually(t, func() bool { return len(e.queue) == 6 }, "queue = %d, want the remaining 6", len(e.queue))
+	ticks <- time.Now() // 清空扩容期间的到达计数
+
+	// 处理完两个值，队列中还剩 4 个，这个间隔没有新的值到达
+	for i := 0; i < 2; i++ {
+		gate <- struct{}{}
+		<-results
+	}
+	eventually(t, func() bool { return len(e.queue) == 4 }, "queue = %d, want 4", len(e.queue))
+	ticks <- time.Now()
+	ticks <- time.Now() // 控制循环处理完上一个节拍之后才会接收这一个
+	if w := e.Workers(); w < 3 {
+		t.Fatalf("workers = %d with a backlog of %d, want at most one worker removed per tick", w, len(e.queue))
+	}
+
+	close(gate)
+	for i := 0; i < 8; i++ {
+		<-results
+	}
+	close(in)
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestElasticCancel
+*/
+func TestElasticCancel(t *testing.T) {
+	before := runtime.NumGoroutine()
+	done := make(chan struct{})
+	e := NewElastic(done, Repeat(done, 1), ElasticConfig{MinWorkers: 2, MaxWorkers: 4}, slowSquare)
+	<-e.Out()
+	close(done)
+	for range e.Out() {
+	}
+	checkNoLeak(t, before)
+}
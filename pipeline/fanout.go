@@ -0,0 +1,92 @@
+package pipeline
+
+import "sync"
+
+// OrderedFanOut 启动 workers 个 goroutine 并发地对 valueStream 中的值调用 fn（扇出），
+// 并按照值到达的顺序返回结果（扇入）。
+// 每个值都带有一个序号，结果在重排缓冲区中等待它前面的结果全部发送后才会发送。
+// 已经开始处理但还没有发送的值最多有 window 个，所以重排缓冲区是有界的；
+// window 小于 workers 时按 workers 处理。
+func OrderedFanOut[T, U any](done <-chan struct{}, valueStream <-chan T, workers, window int, fn func(T) U) <-chan U {
+	if workers < 1 {
+		workers = 1
+	}
+	if window < workers {
+		window = workers
+	}
+
+	type job struct {
+		seq int
+		val T
+	}
+	type result struct {
+		seq int
+		val U
+	}
+
+	tokens := make(chan struct{}, window) // 每个正在处理或等待重排的值占用一个令牌
+	jobs := make(chan job)
+	results := make(chan result)
+	orderedStream := make(chan U)
+
+	go func() { // 为每个值分配序号
+		defer close(jobs)
+		seq := 0
+		for v := range OrDone(done, valueStream) {
+			select {
+			case <-done:
+				return
+			case tokens <- struct{}{}:
+			}
+			select {
+			case <-done:
+				return
+			case jobs <- job{seq: seq, val: v}:
+			}
+			seq++
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				select {
+				case <-done:
+					return
+				case results <- result{seq: j.seq, val: fn(j.val)}:
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	go func() { // 重排缓冲区
+		defer close(orderedStream)
+		pending := make(map[int]U, window)
+		next := 0
+		for r := range OrDone(done, results) {
+			pending[r.seq] = r.val
+			for {
+				v, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				select {
+				case <-done:
+					return
+				case orderedStream <- v:
+				}
+				<-tokens
+				next++
+			}
+		}
+	}()
+	return orderedStream
+}
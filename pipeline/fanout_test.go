@@ -0,0 +1,106 @@
+package pipeline
+
+import (
+	"math/rand"
+	"reflect"
+	"runtime"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// jitterSquare 随机耗时的 stage，使得各个 worker 完成的顺序被打乱
+func jitterSquare(v int) int {
+	time.Sleep(time.Duration(rand.Intn(500)) * time.Microsecond)
+	return v * v
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestOrderedFanOut
+*/
+// TestOrderedFanOut 对比 OrderedFanOut 和多个 Map 再 FanIn 的结果：
+// 两者包含相同的值，但只有 OrderedFanOut 保持输入的顺序。
+func TestOrderedFanOut(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	const n, workers = 200, 8
+	want := make([]int, n)
+	for i := range want {
+		want[i] = i * i
+	}
+
+	ordered := collect(OrderedFanOut(done, Generator(done, seq(n)...), workers, 16, jitterSquare))
+	if !reflect.DeepEqual(ordered, want) {
+		t.Fatalf("ordered fan-out lost the input order: %v", ordered)
+	}
+
+	in := Generator(done, seq(n)...)
+	finders := make([]<-chan int, workers)
+	for i := range finders {
+		finders[i] = Map(done, in, jitterSquare)
+	}
+	unordered := collect(FanIn(done, finders...))
+	if reflect.DeepEqual(unordered, want) {
+		t.Log("unordered fan-in happened to keep the order")
+	}
+	sort.Ints(unordered)
+	if !reflect.DeepEqual(unordered, want) {
+		t.Fatalf("fan-in and ordered fan-out disagree: %v", unordered)
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestOrderedFanOutWindow
+*/
+// TestOrderedFanOutWindow 第一个值一直没有处理完时，
+// 后面最多只有 window 个值被开始处理，重排缓冲区不会无限增长。
+func TestOrderedFanOutWindow(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	const window = 6
+	release := make(chan struct{})
+	var started int32
+	fn := func(v int) int {
+		atomic.AddInt32(&started, 1)
+		if v == 0 {
+			<-release
+		}
+		return v
+	}
+
+	out := OrderedFanOut(done, Repeat(done, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9), 4, window, fn)
+	time.Sleep(20 * time.Millisecond)
+	if got := atomic.LoadInt32(&started); got > window {
+		t.Fatalf("started %d items while the head was blocked, want <= %d", got, window)
+	}
+
+	close(release)
+	if got := collect(Take(done, out, 3)); !reflect.DeepEqual(got, []int{0, 1, 2}) {
+		t.Fatalf("got %v", got)
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestOrderedFanOutCancel
+*/
+func TestOrderedFanOutCancel(t *testing.T) {
+	before := runtime.NumGoroutine()
+	done := make(chan struct{})
+	out := OrderedFanOut(done, Repeat(done, 1, 2, 3), 4, 8, jitterSquare)
+	<-out
+	close(done)
+	for range out {
+	}
+	checkNoLeak(t, before)
+}
+
+func seq(n int) []int {
+	s := make([]int, n)
+	for i := range s {
+		s[i] = i
+	}
+	return s
+}
@@ -0,0 +1,68 @@
+package pipeline
+
+import "time"
+
+// WithHeartbeat 对 valueStream 中的每个值调用 fn，返回心跳 channel 和结果 channel
+// 两种心跳：
+//  1. 每个工作单元开始处理之前发出一次心跳
+//  2. pulseInterval 大于 0 时，在等待输入或者等待结果被读取的期间，每隔 pulseInterval 发出一次心跳
+//
+// fn 执行期间不会发出心跳，所以卡在 fn 中的 goroutine 会表现为心跳停止。
+// 心跳 channel 的缓冲区为 1，没有人读取时心跳会被丢弃，不会阻塞工作。
+func WithHeartbeat[T, U any](
+	done <-chan struct{},
+	valueStream <-chan T,
+	pulseInterval time.Duration,
+	fn func(T) U,
+) (<-chan struct{}, <-chan U) {
+	heartbeat := make(chan struct{}, 1)
+	results := make(chan U)
+	go func() {
+		defer close(heartbeat)
+		defer close(results)
+
+		var pulse <-chan time.Time
+		if pulseInterval > 0 {
+			ticker := time.NewTicker(pulseInterval)
+			defer ticker.Stop()
+			pulse = ticker.C
+		}
+		sendPulse := func() {
+			select {
+			case heartbeat <- struct{}{}:
+			default: // 没有人在监听心跳
+			}
+		}
+
+		for {
+			var v T
+			select {
+			case <-done:
+				return
+			case <-pulse:
+				sendPulse()
+				continue
+			case val, ok := <-valueStream:
+				if !ok {
+					return
+				}
+				v = val
+			}
+
+			sendPulse()
+			result := fn(v)
+		sendResult:
+			for {
+				select {
+				case <-done:
+					return
+				case <-pulse:
+					sendPulse()
+				case results <- result:
+					break sendResult
+				}
+			}
+		}
+	}()
+	return heartbeat, results
+}
@@ -0,0 +1,35 @@
+package pipeline
+
+import (
+	"testing"
+	"time"
+)
+
+/*
+go test ./pipeline -v -count=1 -run TestWithHeartbeat
+*/
+func TestWithHeartbeat(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	// 每个工作单元开始时发出心跳
+	heartbeat, results := WithHeartbeat(done, Generator(done, 1, 2, 3), 0, func(v int) int { return v })
+	for want := 1; want <= 3; want++ {
+		if _, ok := <-heartbeat; !ok {
+			t.Fatal("heartbeat closed")
+		}
+		if got := <-results; got != want {
+			t.Fatalf("got %d, want %d", got, want)
+		}
+	}
+
+	// 没有输入时，按照时间间隔发出心跳
+	heartbeat, _ = WithHeartbeat(done, make(chan int), time.Millisecond, func(v int) int { return v })
+	for i := 0; i < 3; i++ {
+		select {
+		case <-heartbeat:
+		case <-time.After(time.Second):
+			t.Fatal("no interval heartbeat")
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package pipeline
+
+import "reflect"
+
+// maxSelectCases reflect.Select 最多支持的 case 数量
+const maxSelectCases = 65536
+
+// maxChannels 一次 reflect.Select 等待的 channel 数量，留一个 case 给 done
+const maxChannels = maxSelectCases - 1
+
+// Or 将任意数量的 channel 组合为一个 channel，
+// 只要其中任意一个 channel 关闭或者写入，返回的 channel 就会关闭。
+// 书中的 or 每三个 channel 递归地创建一个 goroutine，
+// Or 使用 reflect.Select 在一个 goroutine 中同时等待所有的 channel。
+// 没有任何 channel 时返回 nil，读取它会永远阻塞。
+// 等待的 goroutine 直到某个 channel 关闭或者写入才会退出，
+// 这些 channel 可能永远不会触发时使用 OrWithDone。
+func Or[T any](channels ...<-chan T) <-chan struct{} {
+	return OrWithDone(nil, channels...)
+}
+
+// OrWithDone 和 Or 相同，但 done 关闭时返回的 channel 也会关闭，等待的 goroutine 随之退出。
+// 没有任何 channel 时返回 done。
+func OrWithDone[T any](done <-chan struct{}, channels ...<-chan T) <-chan struct{} {
+	if len(channels) == 0 {
+		return done
+	}
+	if len(channels) > maxChannels {
+		return OrWithDone(done, chunk(channels, func(group ...<-chan T) <-chan struct{} {
+			return OrWithDone(done, group...)
+		})...)
+	}
+
+	orDone := make(chan struct{})
+	go func() {
+		defer close(orDone)
+		reflect.Select(selectCases(done, channels))
+	}()
+	return orDone
+}
+
+// Any 和 Or 相同，但会在关闭返回的 channel 之前，
+// 发送第一个关闭或者写入的 channel 在 channels 中的下标。
+// 和 Or 一样，等待的 goroutine 直到某个 channel 触发才会退出。
+func Any[T any](channels ...<-chan T) <-chan int {
+	return AnyWithDone(nil, channels...)
+}
+
+// AnyWithDone 和 Any 相同，但 done 关闭时返回的 channel 会直接关闭，不发送下标。
+// 和 OrWithDone 一样，没有任何 channel 时返回的 channel 随 done 关闭，done 为 nil 时返回 nil。
+func AnyWithDone[T any](done <-chan struct{}, channels ...<-chan T) <-chan int {
+	if len(channels) == 0 && done == nil {
+		return nil
+	}
+
+	first := make(chan int, 1)
+	go func() {
+		defer close(first)
+		if len(channels) <= maxChannels {
+			if chosen, _, _ := reflect.Select(selectCases(done, channels)); chosen < len(channels) {
+				first <- chosen
+			}
+			return
+		}
+		// 超过 reflect.Select 的上限时分组，先找到组，再找到组内的下标
+		groups := make([]<-chan int, 0, len(channels)/maxChannels+1)
+		for lo := 0; lo < len(channels); lo += maxChannels {
+			groups = append(groups, AnyWithDone(done, channels[lo:min(lo+maxChannels, len(channels))]...))
+		}
+		chosen, index, ok := reflect.Select(selectCases(done, groups))
+		if chosen < len(groups) && ok {
+			first <- chosen*maxChannels + int(index.Int())
+		}
+	}()
+	return first
+}
+
+// All 将任意数量的 channel 组合为一个 channel，
+// 所有的 channel 都关闭或者写入过之后，返回的 channel 才会关闭。
+// 没有任何 channel 时返回一个已经关闭的 channel。
+func All[T any](channels ...<-chan T) <-chan struct{} {
+	allDone := make(chan struct{})
+	if len(channels) == 0 {
+		close(allDone)
+		return allDone
+	}
+	if len(channels) > maxChannels {
+		return All(chunk(channels, All[T])...)
+	}
+
+	go func() {
+		defer close(allDone)
+		cases := selectCases(nil, channels)
+		for remaining := len(channels); remaining > 0; remaining-- {
+			chosen, _, _ := reflect.Select(cases)
+			cases[chosen].Chan = reflect.Value{} // 零值的 case 会被 reflect.Select 忽略
+		}
+	}()
+	return allDone
+}
+
+// selectCases 返回读取 channels 的 case，done 不为 nil 时在最后追加读取 done 的 case
+func selectCases[T any](done <-chan struct{}, channels []<-chan T) []reflect.SelectCase {
+	cases := make([]reflect.SelectCase, len(channels), len(channels)+1)
+	for i, c := range channels {
+		cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c)}
+	}
+	if done != nil {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)})
+	}
+	return cases
+}
+
+// chunk 将 channels 按照 reflect.Select 的上限分组，每组用 combine 组合为一个 channel
+func chunk[T any](channels []<-chan T, combine func(...<-chan T) <-chan struct{}) []<-chan struct{} {
+	groups := make([]<-chan struct{}, 0, len(channels)/maxChannels+1)
+	for lo := 0; lo < len(channels); lo += maxChannels {
+		groups = append(groups, combine(channels[lo:min(lo+maxChannels, len(channels))]...))
+	}
+	return groups
+}
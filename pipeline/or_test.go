@@ -0,0 +1,247 @@
+package pipeline
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// recursiveOr 书中递归版本的 or，用于和 Or 对比
+// 注意递归时传入的是 channels[3:]，第四章最初的代码写成了 channels[:3]，
+// 会不停地用同样的三个 channel 递归，直到其中一个关闭之前不断创建新的 goroutine。
+func recursiveOr(channels ...<-chan struct{}) <-chan struct{} {
+	switch len(channels) {
+	case 0:
+		return nil
+	case 1:
+		return channels[0]
+	}
+
+	orDone := make(chan struct{})
+	go func() {
+		defer close(orDone)
+		switch len(channels) {
+		case 2:
+			select {
+			case <-channels[0]:
+			case <-channels[1]:
+			}
+		default:
+			select {
+			case <-channels[0]:
+			case <-channels[1]:
+			case <-channels[2]:
+			case <-recursiveOr(append(channels[3:], orDone)...):
+			}
+		}
+	}()
+	return orDone
+}
+
+func newSignals(n int) ([]<-chan struct{}, []chan struct{}) {
+	readers := make([]<-chan struct{}, n)
+	writers := make([]chan struct{}, n)
+	for i := range writers {
+		writers[i] = make(chan struct{})
+		readers[i] = writers[i]
+	}
+	return readers, writers
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestOr
+*/
+func TestOr(t *testing.T) {
+	if Or[struct{}]() != nil {
+		t.Fatal("Or without channels should be nil")
+	}
+
+	before := runtime.NumGoroutine()
+	readers, writers := newSignals(1000)
+	orDone := Or(readers...)
+	if g := runtime.NumGoroutine() - before; g > 1 {
+		t.Fatalf("Or started %d goroutines, want 1", g)
+	}
+
+	select {
+	case <-orDone:
+		t.Fatal("Or closed before any channel")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	writers[500] <- struct{}{} // 写入和关闭都会触发
+	select {
+	case <-orDone:
+	case <-time.After(time.Second):
+		t.Fatal("Or did not close")
+	}
+	checkNoLeak(t, before)
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestAny
+*/
+func TestAny(t *testing.T) {
+	readers, writers := newSignals(100)
+	first := Any(readers...)
+	close(writers[42])
+	if got := <-first; got != 42 {
+		t.Fatalf("got %d, want 42", got)
+	}
+	if _, ok := <-first; ok {
+		t.Fatal("Any should close after sending the index")
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestAll
+*/
+func TestAll(t *testing.T) {
+	select {
+	case <-All[struct{}]():
+	default:
+		t.Fatal("All without channels should be closed")
+	}
+
+	readers, writers := newSignals(100)
+	allDone := All(readers...)
+	for i, w := range writers {
+		select {
+		case <-allDone:
+			t.Fatalf("All closed after %d of %d channels", i, len(writers))
+		default:
+		}
+		close(w)
+	}
+	select {
+	case <-allDone:
+	case <-time.After(time.Second):
+		t.Fatal("All did not close")
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestOrLarge
+*/
+// TestOrLarge 超过 reflect.Select 上限的 channel 数量
+func TestOrLarge(t *testing.T) {
+	readers, writers := newSignals(maxSelectCases + 10)
+	orDone, first := Or(readers...), Any(readers...)
+	close(writers[maxSelectCases+5])
+	<-orDone
+	if got := <-first; got != maxSelectCases+5 {
+		t.Fatalf("got %d, want %d", got, maxSelectCases+5)
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestOrWithDone
+*/
+// TestOrWithDone done 关闭后，即使没有任何 channel 触发，等待的 goroutine 也会退出
+func TestOrWithDone(t *testing.T) {
+	before := runtime.NumGoroutine()
+	for _, n := range []int{10, maxSelectCases + 10} {
+		readers, _ := newSignals(n)
+		done := make(chan struct{})
+		orDone, first := OrWithDone(done, readers...), AnyWithDone(done, readers...)
+		close(done)
+		select {
+		case <-orDone:
+		case <-time.After(time.Second):
+			t.Fatalf("%d channels: OrWithDone did not close", n)
+		}
+		if got, ok := <-first; ok {
+			t.Fatalf("%d channels: AnyWithDone sent %d after done", n, got)
+		}
+	}
+	checkNoLeak(t, before)
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestWithDoneNoChannels
+*/
+// TestWithDoneNoChannels 没有任何 channel 时，OrWithDone 和 AnyWithDone 都随 done 关闭
+func TestWithDoneNoChannels(t *testing.T) {
+	if OrWithDone[struct{}](nil) != nil || AnyWithDone[struct{}](nil) != nil {
+		t.Fatal("without channels and done, want nil")
+	}
+
+	done := make(chan struct{})
+	orDone, first := OrWithDone[struct{}](done), AnyWithDone[struct{}](done)
+	select {
+	case <-orDone:
+		t.Fatal("OrWithDone closed before done")
+	case <-first:
+		t.Fatal("AnyWithDone closed before done")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(done)
+	<-orDone
+	if got, ok := <-first; ok {
+		t.Fatalf("AnyWithDone sent %d, want it closed without an index", got)
+	}
+}
+
+// settledGoroutines 等待 goroutine 数量不再变化后返回
+// 递归版本的 or 在每一层的 goroutine 运行后才会创建下一层。
+func settledGoroutines() int {
+	n := runtime.NumGoroutine()
+	for {
+		time.Sleep(time.Millisecond)
+		next := runtime.NumGoroutine()
+		if next == n {
+			return n
+		}
+		n = next
+	}
+}
+
+/*
+go test ./pipeline -run XXX -bench BenchmarkOr -benchmem
+*/
+// BenchmarkOr 对比 Or 和修正过的递归版本的 or（recursive-fixed，见 recursiveOr）在 10、1k、10k 个 channel 时
+// 创建的 goroutine 数量（goroutines/op）以及最后一个 channel 关闭到
+// 组合的 channel 关闭的延迟（latency-ns/op）。
+func BenchmarkOr(b *testing.B) {
+	impls := []struct {
+		name string
+		or   func(...<-chan struct{}) <-chan struct{}
+	}{
+		{"flat", Or[struct{}]},
+		{"recursive-fixed", recursiveOr},
+	}
+
+	for _, n := range []int{10, 1000, 10000} {
+		for _, impl := range impls {
+			b.Run(fmt.Sprintf("%s-%d", impl.name, n), func(b *testing.B) {
+				var goroutines int
+				var latency time.Duration
+				for i := 0; i < b.N; i++ {
+					b.StopTimer()
+					readers, writers := newSignals(n)
+					before := runtime.NumGoroutine()
+					b.StartTimer()
+
+					orDone := impl.or(readers...)
+					b.StopTimer()
+					goroutines += settledGoroutines() - before
+					b.StartTimer()
+					start := time.Now()
+					close(writers[n-1])
+					<-orDone
+					latency += time.Since(start)
+
+					b.StopTimer()
+					for runtime.NumGoroutine() > before { // 等待所有 goroutine 退出
+						runtime.Gosched()
+					}
+					b.StartTimer()
+				}
+				b.ReportMetric(float64(goroutines)/float64(b.N), "goroutines/op")
+				b.ReportMetric(float64(latency.Nanoseconds())/float64(b.N), "latency-ns/op")
+			})
+		}
+	}
+}
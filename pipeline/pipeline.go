@@ -0,0 +1,215 @@
+// Package pipeline 第四章中各个 pipeline stage 的泛型实现
+// 每个 stage 都接收一个 done channel，done 关闭后 stage 内部的 goroutine 会退出，
+// 所以可以直接传入 ctx.Done() 来使用 context 取消整条 pipeline；
+// 需要区分 stream 是正常结束还是被取消时，使用接收 ctx 的版本（GeneratorCtx、MapCtx 等）和 Collect。
+package pipeline
+
+import "sync"
+
+// Generator 将离散值转换为 channel，发送完所有值后关闭 channel
+func Generator[T any](done <-chan struct{}, values ...T) <-chan T {
+	valueStream := make(chan T)
+	go func() {
+		defer close(valueStream)
+		for _, v := range values {
+			select {
+			case <-done:
+				return
+			case valueStream <- v:
+			}
+		}
+	}()
+	return valueStream
+}
+
+// Repeat 无限重复地发送 values，直到 done 关闭
+// values 为空时直接关闭返回的 channel，避免空转。
+func Repeat[T any](done <-chan struct{}, values ...T) <-chan T {
+	valueStream := make(chan T)
+	go func() {
+		defer close(valueStream)
+		if len(values) == 0 {
+			return
+		}
+		for {
+			for _, v := range values {
+				select {
+				case <-done:
+					return
+				case valueStream <- v:
+				}
+			}
+		}
+	}()
+	return valueStream
+}
+
+// RepeatFn 重复调用 fn，并发送其返回值，直到 done 关闭
+func RepeatFn[T any](done <-chan struct{}, fn func() T) <-chan T {
+	valueStream := make(chan T)
+	go func() {
+		defer close(valueStream)
+		for {
+			select {
+			case <-done:
+				return
+			case valueStream <- fn():
+			}
+		}
+	}()
+	return valueStream
+}
+
+// Take 只会从 valueStream 中取出前 num 个值
+// 如果 valueStream 提前关闭，返回的 channel 也随之关闭，取出的值会少于 num 个。
+func Take[T any](done <-chan struct{}, valueStream <-chan T, num int) <-chan T {
+	takeStream := make(chan T)
+	go func() {
+		defer close(takeStream)
+		for i := 0; i < num; i++ {
+			var v T
+			select {
+			case <-done:
+				return
+			case val, ok := <-valueStream:
+				if !ok {
+					return
+				}
+				v = val
+			}
+			select {
+			case <-done:
+				return
+			case takeStream <- v:
+			}
+		}
+	}()
+	return takeStream
+}
+
+// Map 对 valueStream 中的每个值调用 fn，并发送其结果
+// 用于替代 toInt、toString 这类类型转换的 stage。
+func Map[T, U any](done <-chan struct{}, valueStream <-chan T, fn func(T) U) <-chan U {
+	mapStream := make(chan U)
+	go func() {
+		defer close(mapStream)
+		for v := range OrDone(done, valueStream) {
+			select {
+			case <-done:
+				return
+			case mapStream <- fn(v):
+			}
+		}
+	}()
+	return mapStream
+}
+
+// OrDone 封装了从 c 读取时对 done 的检查，
+// 调用方可以直接使用 for-range，而不用再嵌套 select。
+func OrDone[T any](done <-chan struct{}, c <-chan T) <-chan T {
+	valStream := make(chan T)
+	go func() {
+		defer close(valStream)
+		for {
+			select {
+			case <-done:
+				return
+			case v, ok := <-c:
+				if !ok {
+					return
+				}
+				select {
+				case valStream <- v:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+	return valStream
+}
+
+// Tee 将 in 中的每个值同时发送到两个返回的 channel 中
+// 两个 channel 都接收到当前值之后，才会读取 in 的下一个值。
+func Tee[T any](done <-chan struct{}, in <-chan T) (<-chan T, <-chan T) {
+	out1 := make(chan T)
+	out2 := make(chan T)
+	go func() {
+		defer close(out2)
+		defer close(out1)
+		for val := range OrDone(done, in) {
+			var out1, out2 = out1, out2 // 使用本地变量，发送后置为 nil 以阻塞对应的 case
+			for i := 0; i < 2; i++ {
+				select {
+				case <-done:
+					return
+				case out1 <- val:
+					out1 = nil
+				case out2 <- val:
+					out2 = nil
+				}
+			}
+		}
+	}()
+	return out1, out2
+}
+
+// Bridge 将 channel 的 channel 拆解为一个简单的 channel
+// 按照 chanStream 中 channel 的顺序依次读取每个 channel 的值。
+func Bridge[T any](done <-chan struct{}, chanStream <-chan (<-chan T)) <-chan T {
+	valStream := make(chan T)
+	go func() {
+		defer close(valStream)
+		for {
+			var stream <-chan T
+			select {
+			case maybeStream, ok := <-chanStream:
+				if !ok {
+					return
+				}
+				stream = maybeStream
+			case <-done:
+				return
+			}
+
+			for val := range OrDone(done, stream) {
+				select {
+				case valStream <- val:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+	return valStream
+}
+
+// FanIn 将多个 channel 复用到一个 channel 中（扇入）
+// 值的顺序不做保证，所有 channel 关闭后返回的 channel 才会关闭。
+func FanIn[T any](done <-chan struct{}, channels ...<-chan T) <-chan T {
+	var wg sync.WaitGroup
+	multiplexedStream := make(chan T)
+
+	multiplex := func(c <-chan T) {
+		defer wg.Done()
+		for i := range OrDone(done, c) {
+			select {
+			case <-done:
+				return
+			case multiplexedStream <- i:
+			}
+		}
+	}
+
+	wg.Add(len(channels))
+	for _, c := range channels {
+		go multiplex(c)
+	}
+
+	go func() {
+		wg.Wait()
+		close(multiplexedStream)
+	}()
+
+	return multiplexedStream
+}
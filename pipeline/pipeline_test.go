@@ -0,0 +1,222 @@
+package pipeline
+
+import (
+	"reflect"
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+)
+
+// checkNoLeak 在 done 关闭之后，等待 goroutine 数量回落到 before
+func checkNoLeak(t *testing.T, before int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			t.Fatalf("goroutine leaked: before=%d after=%d\n%s",
+				before, runtime.NumGoroutine(), buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func collect[T any](c <-chan T) []T {
+	var vals []T
+	for v := range c {
+		vals = append(vals, v)
+	}
+	return vals
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestGenerator
+*/
+func TestGenerator(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	got := collect(Generator(done, 1, 2, 3))
+	if want := []int{1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestRepeatTake
+*/
+func TestRepeatTake(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	got := collect(Take(done, Repeat(done, "I", "am."), 5))
+	if want := []string{"I", "am.", "I", "am.", "I"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	if got := collect(Take(done, Repeat[int](done), 3)); len(got) != 0 {
+		t.Fatalf("repeat without values should be empty, got %v", got)
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestRepeatFnMap
+*/
+func TestRepeatFnMap(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	var n int
+	counter := func() int { n++; return n }
+	double := func(v int) int { return v * 2 }
+
+	got := collect(Take(done, Map(done, RepeatFn(done, counter), double), 3))
+	if want := []int{2, 4, 6}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestTee
+*/
+func TestTee(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	out1, out2 := Tee(done, Generator(done, 1, 2, 3, 4))
+	for want := 1; want <= 4; want++ {
+		v1, v2 := <-out1, <-out2
+		if v1 != want || v2 != want {
+			t.Fatalf("got (%d, %d), want %d", v1, v2, want)
+		}
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestBridge
+*/
+func TestBridge(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	genVals := func() <-chan (<-chan int) {
+		chanStream := make(chan (<-chan int))
+		go func() {
+			defer close(chanStream)
+			for i := 0; i < 10; i++ {
+				chanStream <- Generator(done, i)
+			}
+		}()
+		return chanStream
+	}
+
+	got := collect(Bridge(done, genVals()))
+	if want := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestFanIn
+*/
+func TestFanIn(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	got := collect(FanIn(done, Generator(done, 1, 2), Generator(done, 3), Generator(done, 4, 5)))
+	sort.Ints(got)
+	if want := []int{1, 2, 3, 4, 5}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestCancelNoLeak
+*/
+// TestCancelNoLeak 每个 stage 都接上无限的上游，读取部分值后关闭 done，
+// 所有 stage 的 goroutine 都必须退出。
+func TestCancelNoLeak(t *testing.T) {
+	stages := map[string]func(done <-chan struct{}) []<-chan int{
+		"Generator": func(done <-chan struct{}) []<-chan int {
+			return []<-chan int{Generator(done, 1, 2, 3)}
+		},
+		"Repeat": func(done <-chan struct{}) []<-chan int {
+			return []<-chan int{Repeat(done, 1)}
+		},
+		"RepeatFn": func(done <-chan struct{}) []<-chan int {
+			return []<-chan int{RepeatFn(done, func() int { return 1 })}
+		},
+		"Take": func(done <-chan struct{}) []<-chan int {
+			return []<-chan int{Take(done, Repeat(done, 1), 100)}
+		},
+		"Map": func(done <-chan struct{}) []<-chan int {
+			return []<-chan int{Map(done, Repeat(done, 1), func(v int) int { return v })}
+		},
+		"OrDone": func(done <-chan struct{}) []<-chan int {
+			return []<-chan int{OrDone(done, make(chan int))}
+		},
+		"Tee": func(done <-chan struct{}) []<-chan int {
+			out1, out2 := Tee(done, Repeat(done, 1))
+			return []<-chan int{out1, out2}
+		},
+		"Bridge": func(done <-chan struct{}) []<-chan int {
+			return []<-chan int{Bridge(done, Repeat(done, Repeat(done, 1)))}
+		},
+		"FanIn": func(done <-chan struct{}) []<-chan int {
+			return []<-chan int{FanIn(done, Repeat(done, 1), make(chan int))}
+		},
+	}
+
+	for name, stage := range stages {
+		stage := stage
+		t.Run(name, func(t *testing.T) {
+			before := runtime.NumGoroutine()
+			done := make(chan struct{})
+			outs := stage(done)
+			select {
+			case <-outs[0]: // 读取一个值，保证 stage 已经在运行
+			case <-time.After(10 * time.Millisecond):
+			}
+			close(done)
+			for _, out := range outs {
+				for range out { // 关闭 done 之后，输出 channel 必须被关闭
+				}
+			}
+			checkNoLeak(t, before)
+		})
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestTakeForwardsValues
+*/
+// TestTakeForwardsValues 回归测试：take 必须发送上游的值，而不是上游的 channel
+func TestTakeForwardsValues(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	var n int
+	got := collect(Take(done, RepeatFn(done, func() int { n++; return n }), 5))
+	if want := []int{1, 2, 3, 4, 5}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestTakeUpstreamClosesEarly
+*/
+// TestTakeUpstreamClosesEarly 上游提前关闭时，take 返回少于 num 个值，而不是零值
+func TestTakeUpstreamClosesEarly(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	got := collect(Take(done, Generator(done, 1, 2, 3), 10))
+	if want := []int{1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	if got := collect(Take(done, Generator(done, 1, 2, 3), 0)); len(got) != 0 {
+		t.Fatalf("take 0 should be empty, got %v", got)
+	}
+}
@@ -0,0 +1,151 @@
+package pipeline
+
+import (
+	"errors"
+	"sync"
+)
+
+// OverflowPolicy 队列已满时对新到达的值的处理策略
+type OverflowPolicy int
+
+const (
+	// Block 队列已满时停止从上游读取，将压力反馈给上游（背压）
+	Block OverflowPolicy = iota
+	// DropNewest 队列已满时丢弃新到达的值
+	DropNewest
+	// DropOldest 队列已满时丢弃队头最旧的值，为新值腾出位置
+	DropOldest
+	// FailOnFull 队列已满时停止读取上游，发送完已缓冲的值后关闭输出，
+	// 并通过 Err 返回 ErrQueueFull
+	FailOnFull
+)
+
+// ErrQueueFull 在 FailOnFull 策略下队列溢出时返回
+var ErrQueueFull = errors.New("pipeline: queue is full")
+
+// QueueStats 队列的计数器
+// 根据利特尔法则 L = λW，可以用 Len 和吞吐量估算值在队列中的平均等待时间。
+type QueueStats struct {
+	Enqueued  int64 // 进入队列的值的数量
+	Dequeued  int64 // 发送给下游的值的数量
+	Dropped   int64 // 因为队列已满而丢弃的值的数量
+	Len       int   // 当前队列中值的数量
+	HighWater int   // 队列长度的历史最大值
+}
+
+// Queue 可以插入在任意两个 stage 之间的有界队列
+type Queue[T any] struct {
+	capacity int
+	policy   OverflowPolicy
+	out      chan T
+
+	mu    sync.Mutex
+	stats QueueStats
+	err   error
+}
+
+// NewQueue 在 in 和返回的队列的 Out 之间插入一个容量为 capacity 的缓冲区
+// capacity 小于 1 时按 1 处理。
+func NewQueue[T any](done <-chan struct{}, in <-chan T, capacity int, policy OverflowPolicy) *Queue[T] {
+	if capacity < 1 {
+		capacity = 1
+	}
+	q := &Queue[T]{
+		capacity: capacity,
+		policy:   policy,
+		out:      make(chan T),
+	}
+	go q.run(done, in)
+	return q
+}
+
+// Out 返回队列的输出 channel
+func (q *Queue[T]) Out() <-chan T {
+	return q.out
+}
+
+// Stats 返回当前计数器的快照
+func (q *Queue[T]) Stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.stats
+}
+
+// Err 在 FailOnFull 策略下队列溢出后返回 ErrQueueFull，否则返回 nil
+func (q *Queue[T]) Err() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.err
+}
+
+func (q *Queue[T]) run(done <-chan struct{}, in <-chan T) {
+	defer close(q.out)
+
+	buf := make([]T, 0, q.capacity)
+	for {
+		inStream := in
+		if q.policy == Block && len(buf) >= q.capacity {
+			inStream = nil // 队列已满，暂停读取上游
+		}
+		if in == nil && len(buf) == 0 {
+			return
+		}
+
+		var outStream chan<- T
+		var next T
+		if len(buf) > 0 {
+			outStream = q.out
+			next = buf[0]
+		}
+
+		select {
+		case <-done:
+			return
+		case v, ok := <-inStream:
+			if !ok {
+				in = nil
+				continue
+			}
+			buf = q.push(buf, v)
+			if q.Err() != nil {
+				in = nil
+			}
+		case outStream <- next:
+			var zero T
+			buf[0] = zero
+			buf = buf[1:]
+			q.mu.Lock()
+			q.stats.Dequeued++
+			q.stats.Len = len(buf)
+			q.mu.Unlock()
+		}
+	}
+}
+
+func (q *Queue[T]) push(buf []T, v T) []T {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(buf) >= q.capacity {
+		switch q.policy {
+		case DropNewest:
+			q.stats.Dropped++
+			return buf
+		case DropOldest:
+			q.stats.Dropped++
+			buf = buf[1:]
+		case FailOnFull:
+			q.stats.Dropped++
+			q.err = ErrQueueFull
+			return buf
+		}
+	}
+
+	buf = append(buf, v)
+	q.stats.Enqueued++
+	q.stats.Len = len(buf)
+	if len(buf) > q.stats.HighWater {
+		q.stats.HighWater = len(buf)
+	}
+	return buf
+}
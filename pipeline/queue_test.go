@@ -0,0 +1,105 @@
+package pipeline
+
+import (
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// filledStream 返回一个已经写入 1..n 并关闭的 channel
+func filledStream(n int) <-chan int {
+	c := make(chan int, n)
+	for i := 1; i <= n; i++ {
+		c <- i
+	}
+	close(c)
+	return c
+}
+
+// waitConsumed 等待队列读完上游的 n 个值（进入队列或者被丢弃）
+func waitConsumed[T any](t *testing.T, q *Queue[T], n int64) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		s := q.Stats()
+		if s.Enqueued+s.Dropped >= n || q.Err() != nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("queue did not consume input: %+v", s)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestQueueBlock
+*/
+func TestQueueBlock(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	q := NewQueue(done, Generator(done, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10), 3, Block)
+	for q.Stats().Len < 3 { // 等待队列被填满
+		time.Sleep(time.Millisecond)
+	}
+
+	got := collect(q.Out())
+	if want := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	s := q.Stats()
+	if s.Enqueued != 10 || s.Dequeued != 10 || s.Dropped != 0 || s.HighWater != 3 || s.Len != 0 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestQueueOverflow
+*/
+func TestQueueOverflow(t *testing.T) {
+	tests := []struct {
+		policy  OverflowPolicy
+		want    []int
+		dropped int64
+		err     error
+	}{
+		{DropNewest, []int{1, 2, 3}, 7, nil},
+		{DropOldest, []int{8, 9, 10}, 7, nil},
+		{FailOnFull, []int{1, 2, 3}, 1, ErrQueueFull},
+	}
+
+	for _, tt := range tests {
+		done := make(chan struct{})
+		q := NewQueue(done, filledStream(10), 3, tt.policy)
+		waitConsumed(t, q, 10)
+
+		got := collect(q.Out())
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("policy %d: got %v, want %v", tt.policy, got, tt.want)
+		}
+		s := q.Stats()
+		if s.Dropped != tt.dropped || s.HighWater != 3 {
+			t.Errorf("policy %d: unexpected stats: %+v", tt.policy, s)
+		}
+		if q.Err() != tt.err {
+			t.Errorf("policy %d: got err %v, want %v", tt.policy, q.Err(), tt.err)
+		}
+		close(done)
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestQueueCancel
+*/
+func TestQueueCancel(t *testing.T) {
+	before := runtime.NumGoroutine()
+	done := make(chan struct{})
+	q := NewQueue(done, Repeat(done, 1), 5, DropOldest)
+	<-q.Out()
+	close(done)
+	for range q.Out() {
+	}
+	checkNoLeak(t, before)
+}
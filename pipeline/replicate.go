@@ -0,0 +1,105 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNoReplicas FirstOf 没有收到任何副本
+var ErrNoReplicas = errors.New("pipeline: no replicas")
+
+// ErrAllReplicasFailed 所有副本都返回了错误
+var ErrAllReplicasFailed = errors.New("pipeline: all replicas failed")
+
+// ErrCanceled done 在得到结果之前被关闭
+var ErrCanceled = errors.New("pipeline: canceled")
+
+// Replica 复制请求的一个副本，done 关闭时应该尽快返回
+type Replica[T any] func(done <-chan struct{}) (T, error)
+
+// HedgeOptions FirstOf 的配置
+type HedgeOptions struct {
+	// Delay 启动下一个副本之前等待的时间，0 表示同时启动所有副本。
+	// 正在运行的副本全部失败时，不再等待，立即启动下一个副本。
+	Delay time.Duration
+}
+
+// FirstOf 将同一个请求发送给多个副本，返回第一个成功的结果和副本的下标
+// 得到结果之后，其余的副本通过 done 被取消。
+// 所有副本都失败时返回包装了 ErrAllReplicasFailed 和每个副本错误的错误，
+// done 先被关闭时返回 ErrCanceled，两种情况下副本下标都为 -1。
+func FirstOf[T any](done <-chan struct{}, opts HedgeOptions, replicas ...Replica[T]) (int, T, error) {
+	var zero T
+	if len(replicas) == 0 {
+		return -1, zero, ErrNoReplicas
+	}
+
+	stop := make(chan struct{})
+	defer close(stop) // 取消还在运行的副本
+	replicaDone := Or(done, stop)
+
+	// 缓冲区足够大，被取消的副本不会阻塞在发送上
+	results := make(chan Indexed[Result[T]], len(replicas))
+	launch := func(i int) {
+		go func() {
+			v, err := replicas[i](replicaDone)
+			results <- Indexed[Result[T]]{Stream: i, Value: Result[T]{Value: v, Err: err}}
+		}()
+	}
+
+	launched := 0
+	if opts.Delay <= 0 {
+		for ; launched < len(replicas); launched++ {
+			launch(launched)
+		}
+	} else {
+		launch(0)
+		launched = 1
+	}
+
+	// 所有副本共用一个计时器，hedge 为 nil 时不再启动新的副本
+	var timer *time.Timer
+	var hedge <-chan time.Time
+	if launched < len(replicas) {
+		timer = time.NewTimer(opts.Delay)
+		defer timer.Stop()
+		hedge = timer.C
+	}
+	launchNext := func() {
+		launch(launched)
+		launched++
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if launched == len(replicas) {
+			hedge = nil
+			return
+		}
+		timer.Reset(opts.Delay)
+	}
+
+	errs := make([]error, 0, len(replicas))
+	for {
+		select {
+		case <-done:
+			return -1, zero, ErrCanceled
+		case <-hedge:
+			launchNext()
+		case r := <-results:
+			if r.Value.Err == nil {
+				return r.Stream, r.Value.Value, nil
+			}
+			errs = append(errs, fmt.Errorf("replica %d: %w", r.Stream, r.Value.Err))
+			if len(errs) == len(replicas) {
+				return -1, zero, fmt.Errorf("%w: %w", ErrAllReplicasFailed, errors.Join(errs...))
+			}
+			if len(errs) == launched { // 没有正在运行的副本，立即启动下一个
+				launchNext()
+			}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package pipeline
+
+import (
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeHandler 经过 latency 之后返回 value 或者 err，被取消时计数加一
+func fakeHandler(latency time.Duration, value int, err error, canceled *int32) Replica[int] {
+	return func(done <-chan struct{}) (int, error) {
+		select {
+		case <-done:
+			atomic.AddInt32(canceled, 1)
+			return 0, errors.New("canceled")
+		case <-time.After(latency):
+			return value, err
+		}
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestFirstOfFastestWins
+*/
+func TestFirstOfFastestWins(t *testing.T) {
+	before := runtime.NumGoroutine()
+	done := make(chan struct{})
+	defer close(done)
+
+	var canceled int32
+	winner, v, err := FirstOf(done, HedgeOptions{},
+		fakeHandler(time.Second, 0, nil, &canceled),
+		fakeHandler(10*time.Millisecond, 1, nil, &canceled),
+		fakeHandler(time.Second, 2, nil, &canceled),
+	)
+	if err != nil || winner != 1 || v != 1 {
+		t.Fatalf("got winner %d value %d err %v, want replica 1", winner, v, err)
+	}
+	checkNoLeak(t, before) // 其余两个副本被取消
+	if n := atomic.LoadInt32(&canceled); n != 2 {
+		t.Fatalf("%d replicas canceled, want 2", n)
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestFirstOfSkipsFailures
+*/
+func TestFirstOfSkipsFailures(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	var canceled int32
+	errFailed := errors.New("failed")
+	winner, v, err := FirstOf(done, HedgeOptions{},
+		fakeHandler(time.Millisecond, 0, errFailed, &canceled),
+		fakeHandler(20*time.Millisecond, 1, nil, &canceled),
+	)
+	if err != nil || winner != 1 || v != 1 {
+		t.Fatalf("got winner %d value %d err %v, want replica 1", winner, v, err)
+	}
+
+	winner, _, err = FirstOf(done, HedgeOptions{},
+		fakeHandler(time.Millisecond, 0, errFailed, &canceled),
+		fakeHandler(2*time.Millisecond, 0, errFailed, &canceled),
+	)
+	if winner != -1 || !errors.Is(err, ErrAllReplicasFailed) || !errors.Is(err, errFailed) {
+		t.Fatalf("got winner %d err %v, want ErrAllReplicasFailed", winner, err)
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestFirstOfHedgeDelay
+*/
+// TestFirstOfHedgeDelay 第一个副本在 Delay 之内返回时，不会启动其余的副本
+func TestFirstOfHedgeDelay(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	var started int32
+	replica := func(latency time.Duration, value int) Replica[int] {
+		return func(done <-chan struct{}) (int, error) {
+			atomic.AddInt32(&started, 1)
+			select {
+			case <-done:
+				return 0, errors.New("canceled")
+			case <-time.After(latency):
+				return value, nil
+			}
+		}
+	}
+
+	winner, _, err := FirstOf(done, HedgeOptions{Delay: 50 * time.Millisecond},
+		replica(time.Millisecond, 0), replica(time.Millisecond, 1))
+	if err != nil || winner != 0 || atomic.LoadInt32(&started) != 1 {
+		t.Fatalf("got winner %d err %v started %d, want only replica 0", winner, err, started)
+	}
+
+	// 第一个副本太慢，Delay 之后启动的第二个副本先返回
+	atomic.StoreInt32(&started, 0)
+	winner, v, err := FirstOf(done, HedgeOptions{Delay: 10 * time.Millisecond},
+		replica(time.Second, 0), replica(time.Millisecond, 1), replica(time.Millisecond, 2))
+	if err != nil || winner != 1 || v != 1 {
+		t.Fatalf("got winner %d value %d err %v, want replica 1", winner, v, err)
+	}
+	if n := atomic.LoadInt32(&started); n != 2 {
+		t.Fatalf("%d replicas started, want 2", n)
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestFirstOfCanceled
+*/
+func TestFirstOfCanceled(t *testing.T) {
+	done := make(chan struct{})
+	time.AfterFunc(10*time.Millisecond, func() { close(done) })
+
+	var canceled int32
+	winner, _, err := FirstOf(done, HedgeOptions{}, fakeHandler(time.Second, 0, nil, &canceled))
+	if winner != -1 || !errors.Is(err, ErrCanceled) {
+		t.Fatalf("got winner %d err %v, want ErrCanceled", winner, err)
+	}
+	if _, _, err := FirstOf[int](done, HedgeOptions{}); !errors.Is(err, ErrNoReplicas) {
+		t.Fatalf("got %v, want ErrNoReplicas", err)
+	}
+}
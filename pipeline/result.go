@@ -0,0 +1,157 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Result 将值和可能出现的错误结合在一起，通过同一个 channel 传递
+// 错误应该被视为一等公民，和结果一起返回给掌握更多上下文的调用方。
+type Result[T any] struct {
+	Value T
+	Err   error
+}
+
+// Try 对 valueStream 中的每个值调用 fn，并将返回值和错误包装为 Result
+// 用于将任意可能出错的 stage 接入 Result 流。
+func Try[T, U any](done <-chan struct{}, valueStream <-chan T, fn func(T) (U, error)) <-chan Result[U] {
+	resultStream := make(chan Result[U])
+	go func() {
+		defer close(resultStream)
+		for v := range OrDone(done, valueStream) {
+			value, err := fn(v)
+			select {
+			case <-done:
+				return
+			case resultStream <- Result[U]{Value: value, Err: err}:
+			}
+		}
+	}()
+	return resultStream
+}
+
+// ErrTooManyErrors 在 MaxErrors 和 ErrorRate 策略终止 Result 流时返回
+var ErrTooManyErrors = errors.New("pipeline: too many errors")
+
+// ErrorPolicy 决定 Result 流遇到错误后是否继续
+// 同一个 ErrorPolicy 只能用于一个 Result 流。
+type ErrorPolicy interface {
+	// Observe 在每个 Result 到达时以其 Err 调用，返回非 nil 时整个流停止
+	Observe(err error) error
+}
+
+// ErrorPolicyFunc 将普通函数转换为 ErrorPolicy
+type ErrorPolicyFunc func(err error) error
+
+// Observe 调用 f(err)
+func (f ErrorPolicyFunc) Observe(err error) error {
+	return f(err)
+}
+
+// FailFast 遇到第一个错误时停止
+func FailFast() ErrorPolicy {
+	return ErrorPolicyFunc(func(err error) error {
+		return err
+	})
+}
+
+// MaxErrors 错误累计达到 n 个时停止
+func MaxErrors(n int) ErrorPolicy {
+	var errCount int
+	return ErrorPolicyFunc(func(err error) error {
+		if err == nil {
+			return nil
+		}
+		errCount++
+		if errCount >= n {
+			return fmt.Errorf("%w: %d errors, last: %w", ErrTooManyErrors, errCount, err)
+		}
+		return nil
+	})
+}
+
+// ErrorRate 在最近 window 个 Result 中，错误所占的比例超过 rate 时停止
+// 到达的 Result 不足 window 个时不会停止。
+func ErrorRate(rate float64, window int) ErrorPolicy {
+	if window < 1 {
+		window = 1
+	}
+	failed := make([]bool, window) // 环形缓冲区，记录最近 window 个 Result 是否出错
+	var seen, errCount int
+	return ErrorPolicyFunc(func(err error) error {
+		i := seen % window
+		if failed[i] {
+			errCount--
+		}
+		failed[i] = err != nil
+		if failed[i] {
+			errCount++
+		}
+		seen++
+
+		if seen >= window && float64(errCount)/float64(window) > rate {
+			return fmt.Errorf("%w: %d of last %d results failed, last: %w",
+				ErrTooManyErrors, errCount, window, err)
+		}
+		return nil
+	})
+}
+
+// Collector 收集所有的错误，但从不停止 Result 流
+type Collector struct {
+	mu   sync.Mutex
+	errs []error
+}
+
+// CollectAll 返回一个收集所有错误的 Collector
+func CollectAll() *Collector {
+	return &Collector{}
+}
+
+// Observe 记录 err，总是返回 nil
+func (c *Collector) Observe(err error) error {
+	if err != nil {
+		c.mu.Lock()
+		c.errs = append(c.errs, err)
+		c.mu.Unlock()
+	}
+	return nil
+}
+
+// Errors 返回目前为止收集到的所有错误
+func (c *Collector) Errors() []error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]error(nil), c.errs...)
+}
+
+// Err 将收集到的错误合并为一个错误，没有错误时返回 nil
+func (c *Collector) Err() error {
+	return errors.Join(c.Errors()...)
+}
+
+// WithPolicy 使用 policy 包装一个 Result 流
+// policy 要求停止时，触发停止的 Result 会被替换为 Err 为 policy 返回值的 Result，
+// 发送之后关闭返回的 channel。
+func WithPolicy[T any](done <-chan struct{}, resultStream <-chan Result[T], policy ErrorPolicy) <-chan Result[T] {
+	guardedStream := make(chan Result[T])
+	go func() {
+		defer close(guardedStream)
+		for result := range OrDone(done, resultStream) {
+			stop := policy.Observe(result.Err)
+			if stop != nil {
+				result = Result[T]{Err: stop}
+			}
+			select {
+			case <-done:
+				return
+			case guardedStream <- result:
+			}
+			if stop != nil {
+				return
+			}
+		}
+	}()
+	return guardedStream
+}
@@ -0,0 +1,102 @@
+package pipeline
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+// atoiStream 将 strings 转换为 Result 流，无法解析的字符串产生错误
+func atoiStream(done <-chan struct{}, strings ...string) <-chan Result[int] {
+	return Try(done, Generator(done, strings...), strconv.Atoi)
+}
+
+// summarize 返回成功的值以及最后一个 Result 的错误
+func summarize(results <-chan Result[int]) (values []int, errCount int, last error) {
+	for r := range results {
+		if r.Err != nil {
+			errCount++
+			last = r.Err
+			continue
+		}
+		values = append(values, r.Value)
+	}
+	return values, errCount, last
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestTry
+*/
+func TestTry(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	values, errCount, _ := summarize(atoiStream(done, "1", "a", "2"))
+	if len(values) != 2 || errCount != 1 {
+		t.Fatalf("got values=%v errCount=%d", values, errCount)
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestFailFast
+*/
+func TestFailFast(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	values, errCount, last := summarize(WithPolicy(done, atoiStream(done, "1", "a", "2"), FailFast()))
+	var numErr *strconv.NumError
+	if len(values) != 1 || errCount != 1 || !errors.As(last, &numErr) {
+		t.Fatalf("got values=%v errCount=%d last=%v", values, errCount, last)
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestMaxErrors
+*/
+func TestMaxErrors(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	results := atoiStream(done, "a", "1", "b", "c", "d", "2")
+	values, errCount, last := summarize(WithPolicy(done, results, MaxErrors(3)))
+	if len(values) != 1 || errCount != 3 || !errors.Is(last, ErrTooManyErrors) {
+		t.Fatalf("got values=%v errCount=%d last=%v", values, errCount, last)
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestErrorRate
+*/
+func TestErrorRate(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	// 每 4 个中有 1 个错误，错误率 25% 不超过 30%，流不会停止
+	steady := []string{"1", "2", "3", "x", "1", "2", "3", "x", "1", "2", "3", "x"}
+	values, _, last := summarize(WithPolicy(done, atoiStream(done, steady...), ErrorRate(0.3, 4)))
+	if len(values) != 9 || errors.Is(last, ErrTooManyErrors) {
+		t.Fatalf("steady: got values=%v last=%v", values, last)
+	}
+
+	// 错误集中出现，最近 4 个中有 2 个错误，错误率 50% 超过 30%
+	burst := []string{"1", "2", "3", "4", "x", "y", "5", "6"}
+	values, _, last = summarize(WithPolicy(done, atoiStream(done, burst...), ErrorRate(0.3, 4)))
+	if len(values) != 4 || !errors.Is(last, ErrTooManyErrors) {
+		t.Fatalf("burst: got values=%v last=%v", values, last)
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestCollectAll
+*/
+func TestCollectAll(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	collector := CollectAll()
+	values, errCount, _ := summarize(WithPolicy(done, atoiStream(done, "a", "1", "b", "2"), collector))
+	if len(values) != 2 || errCount != 2 || len(collector.Errors()) != 2 || collector.Err() == nil {
+		t.Fatalf("got values=%v errCount=%d collected=%v", values, errCount, collector.Errors())
+	}
+}
@@ -0,0 +1,191 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Ward 被 Steward 监管的工作函数（病区）
+// ward 通过调用 pulse 发出心跳，通过 out 发送结果，发送时需要同时检查 done。
+// 阻塞在 out 上等待下游读取的时间不计入心跳超时。
+// 返回 nil 表示工作已经完成；返回错误、panic 或者心跳超时，Steward 都会重新启动它。
+type Ward[T any] func(done <-chan struct{}, pulse func(), out chan<- T) error
+
+// ErrMissedHeartbeat ward 在 StewardConfig.Timeout 内没有发出心跳
+var ErrMissedHeartbeat = errors.New("pipeline: ward missed heartbeat")
+
+// ErrRestartBudget ward 的重启次数超过了 StewardConfig.MaxRestarts
+var ErrRestartBudget = errors.New("pipeline: restart budget exhausted")
+
+// PanicError ward 发生 panic 时的错误
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("pipeline: ward panicked: %v", e.Value)
+}
+
+// StewardConfig Steward 的配置
+type StewardConfig struct {
+	Timeout     time.Duration // 超过 Timeout 没有心跳时认为 ward 不健康，0 表示不检查心跳
+	Backoff     time.Duration // 第一次重启之前的等待时间，之后每次重启翻倍
+	MaxBackoff  time.Duration // 重启等待时间的上限，0 表示没有上限
+	MaxRestarts int           // 最多重启的次数，0 表示不限制
+
+	// OnRestart 在每次重启之前调用，restart 从 1 开始，reason 是重启的原因
+	OnRestart func(restart int, reason error)
+}
+
+// Steward 监管 ward 的管理员
+// ward 不健康时，Steward 停止它并启动一个新的 ward。
+// Steward 依次转发每个 ward 的输出，消费者看到的是一个连续的流。
+type Steward[T any] struct {
+	cfg  StewardConfig
+	ward Ward[T]
+	out  chan T
+
+	mu       sync.Mutex
+	restarts int
+	err      error
+}
+
+// NewSteward 启动 ward 并开始监管
+// ward 正常结束或者 done 关闭后，Out 返回的 channel 被关闭。
+func NewSteward[T any](done <-chan struct{}, cfg StewardConfig, ward Ward[T]) *Steward[T] {
+	s := &Steward[T]{cfg: cfg, ward: ward, out: make(chan T)}
+	go s.run(done)
+	return s
+}
+
+// Out 返回跨越所有重启的连续输出
+func (s *Steward[T]) Out() <-chan T {
+	return s.out
+}
+
+// Restarts 返回 ward 已经被重启的次数
+func (s *Steward[T]) Restarts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.restarts
+}
+
+// Err 重启次数用完之后返回包装了 ErrRestartBudget 和最后一次重启原因的错误，否则返回 nil
+func (s *Steward[T]) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *Steward[T]) run(done <-chan struct{}) {
+	defer close(s.out)
+
+	backoff := s.cfg.Backoff
+	for {
+		restart, reason := s.supervise(done)
+		if !restart {
+			return
+		}
+
+		s.mu.Lock()
+		if s.cfg.MaxRestarts > 0 && s.restarts >= s.cfg.MaxRestarts {
+			s.err = fmt.Errorf("%w: %w", ErrRestartBudget, reason)
+			s.mu.Unlock()
+			return
+		}
+		s.restarts++
+		restarts := s.restarts
+		s.mu.Unlock()
+
+		if s.cfg.OnRestart != nil {
+			s.cfg.OnRestart(restarts, reason)
+		}
+		select {
+		case <-done:
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if s.cfg.MaxBackoff > 0 && backoff > s.cfg.MaxBackoff {
+			backoff = s.cfg.MaxBackoff
+		}
+	}
+}
+
+// supervise 启动一个 ward，把它的输出转发到 out，直到它结束或者变得不健康
+// 需要重启时返回 true 和重启的原因；ward 正常结束或者 done 关闭时返回 false。
+// ward 发送的值一旦被读取，就一定会交给下游，不会因为重启而丢失。
+func (s *Steward[T]) supervise(done <-chan struct{}) (bool, error) {
+	wardDone := make(chan struct{})
+	beats := make(chan struct{}, 1)
+	wardOut := make(chan T)
+	exited := make(chan error, 1)
+
+	pulse := func() {
+		select {
+		case beats <- struct{}{}:
+		default:
+		}
+	}
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				exited <- &PanicError{Value: r, Stack: debug.Stack()}
+			}
+		}()
+		exited <- s.ward(wardDone, pulse, wardOut)
+	}()
+
+	timeout := time.NewTimer(s.cfg.Timeout)
+	defer timeout.Stop()
+	resetTimeout := func() {
+		if !timeout.Stop() {
+			select {
+			case <-timeout.C:
+			default:
+			}
+		}
+		timeout.Reset(s.cfg.Timeout)
+	}
+
+	// 同一时刻 in 和 out 只有一个不为 nil：要么在读取 ward 的输出，要么在把 pending 交给下游
+	var pending T
+	in, out := (<-chan T)(wardOut), (chan<- T)(nil)
+	for {
+		// Timeout 为 0 时不检查心跳；等待下游读取期间 ward 阻塞在发送上，无法发出心跳，
+		// 这段时间不计入 Timeout，pending 交给下游之后重新计时
+		var timeoutC <-chan time.Time
+		if s.cfg.Timeout > 0 && out == nil {
+			timeoutC = timeout.C
+		}
+		select {
+		case <-done:
+			close(wardDone)
+			return false, nil
+		case <-beats:
+			resetTimeout()
+		case v := <-in:
+			pending, in, out = v, nil, s.out
+		case out <- pending:
+			in, out = wardOut, nil
+			resetTimeout()
+		case <-timeoutC:
+			close(wardDone) // 通知不健康的 ward 退出，此时没有还没交给下游的值
+			return true, ErrMissedHeartbeat
+		case err := <-exited:
+			// ward 的发送都已经完成，只剩下可能还没交给下游的 pending
+			if out != nil {
+				select {
+				case <-done:
+					return false, nil
+				case out <- pending:
+				}
+			}
+			return err != nil, err
+		}
+	}
+}
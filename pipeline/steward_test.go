@@ -0,0 +1,197 @@
+package pipeline
+
+import (
+	"errors"
+	"reflect"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingWard 依次发送 from, from+1, ... to，每个值之前发出一次心跳
+// 每次启动时调用 fault，fault 返回 true 时在发送完第 failAfter 个值之后发生故障。
+func countingWard(to int, failAfter int, fault func(start int) func()) Ward[int] {
+	var next, starts int64 = 1, 0
+	return func(done <-chan struct{}, pulse func(), out chan<- int) error {
+		start := int(atomic.AddInt64(&starts, 1))
+		onFault := fault(start)
+		for sent := 0; ; sent++ {
+			if sent == failAfter && onFault != nil {
+				onFault()
+			}
+			v := int(atomic.LoadInt64(&next))
+			if v > to {
+				return nil
+			}
+			pulse()
+			select {
+			case <-done:
+				return nil
+			case out <- v:
+				atomic.AddInt64(&next, 1)
+			}
+		}
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestStewardCompletes
+*/
+func TestStewardCompletes(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	s := NewSteward(done, StewardConfig{Timeout: time.Second}, countingWard(3, 0, func(int) func() { return nil }))
+	if got := collect(s.Out()); !reflect.DeepEqual(got, []int{1, 2, 3}) {
+		t.Fatalf("got %v, want [1 2 3]", got)
+	}
+	if s.Restarts() != 0 || s.Err() != nil {
+		t.Fatalf("restarts %d err %v, want 0 and nil", s.Restarts(), s.Err())
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestStewardRestartsOnPanic
+*/
+// TestStewardRestartsOnPanic 前两次启动的 ward 在发送两个值之后 panic，消费者看到的仍然是连续的流
+func TestStewardRestartsOnPanic(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	var reasons []error
+	cfg := StewardConfig{
+		Backoff:   time.Millisecond,
+		OnRestart: func(_ int, reason error) { reasons = append(reasons, reason) },
+	}
+	ward := countingWard(6, 2, func(start int) func() {
+		if start > 2 {
+			return nil
+		}
+		return func() { panic("boom") }
+	})
+
+	s := NewSteward(done, cfg, ward)
+	if got := collect(s.Out()); !reflect.DeepEqual(got, []int{1, 2, 3, 4, 5, 6}) {
+		t.Fatalf("got %v, want [1 2 3 4 5 6]", got)
+	}
+	if s.Restarts() != 2 || len(reasons) != 2 {
+		t.Fatalf("restarts %d reasons %v, want 2", s.Restarts(), reasons)
+	}
+	var panicErr *PanicError
+	if !errors.As(reasons[0], &panicErr) || panicErr.Value != "boom" || len(panicErr.Stack) == 0 {
+		t.Fatalf("unexpected reason %v", reasons[0])
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestStewardRestartsOnMissedHeartbeat
+*/
+// TestStewardRestartsOnMissedHeartbeat 第一次启动的 ward 卡住不再发出心跳，只能通过 done 退出
+func TestStewardRestartsOnMissedHeartbeat(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	var reason error
+	cfg := StewardConfig{
+		Timeout:   20 * time.Millisecond,
+		OnRestart: func(_ int, r error) { reason = r },
+	}
+	hung := make(chan struct{})
+	ward := func(wardDone <-chan struct{}, pulse func(), out chan<- int) error {
+		select {
+		case <-hung: // 第一个 ward 已经卡住过
+		default:
+			close(hung)
+			<-wardDone
+			return nil
+		}
+		pulse()
+		select {
+		case <-wardDone:
+		case out <- 1:
+		}
+		return nil
+	}
+
+	s := NewSteward(done, cfg, ward)
+	if got := collect(s.Out()); !reflect.DeepEqual(got, []int{1}) {
+		t.Fatalf("got %v, want [1]", got)
+	}
+	if s.Restarts() != 1 || !errors.Is(reason, ErrMissedHeartbeat) {
+		t.Fatalf("restarts %d reason %v, want 1 and ErrMissedHeartbeat", s.Restarts(), reason)
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestStewardSlowConsumer
+*/
+// TestStewardSlowConsumer 消费者读取得比 Timeout 慢，ward 阻塞在发送上不算心跳超时，不会重启也不会丢失值
+func TestStewardSlowConsumer(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	var reasons []error
+	cfg := StewardConfig{
+		Timeout:   20 * time.Millisecond,
+		OnRestart: func(_ int, reason error) { reasons = append(reasons, reason) },
+	}
+	s := NewSteward(done, cfg, countingWard(5, 0, func(int) func() { return nil }))
+
+	var got []int
+	for v := range s.Out() {
+		time.Sleep(3 * cfg.Timeout)
+		got = append(got, v)
+	}
+	if !reflect.DeepEqual(got, []int{1, 2, 3, 4, 5}) {
+		t.Fatalf("got %v, want [1 2 3 4 5]", got)
+	}
+	if s.Restarts() != 0 {
+		t.Fatalf("restarts %d, want 0: %v", s.Restarts(), reasons)
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestStewardRestartBudget
+*/
+func TestStewardRestartBudget(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	errFailed := errors.New("failed")
+	s := NewSteward(done, StewardConfig{MaxRestarts: 3}, func(<-chan struct{}, func(), chan<- int) error {
+		return errFailed
+	})
+	if got := collect(s.Out()); len(got) != 0 {
+		t.Fatalf("got %v, want nothing", got)
+	}
+	if s.Restarts() != 3 {
+		t.Fatalf("restarts %d, want 3", s.Restarts())
+	}
+	if err := s.Err(); !errors.Is(err, ErrRestartBudget) || !errors.Is(err, errFailed) {
+		t.Fatalf("err %v, want ErrRestartBudget wrapping the last reason", err)
+	}
+}
+
+/*
+go test ./pipeline -v -count=1 -run TestStewardCancelNoLeak
+*/
+// TestStewardCancelNoLeak 关闭 done 之后，steward、ward 和 bridge 的 goroutine 都要退出
+func TestStewardCancelNoLeak(t *testing.T) {
+	before := runtime.NumGoroutine()
+	done := make(chan struct{})
+	s := NewSteward(done, StewardConfig{Timeout: time.Second}, func(wardDone <-chan struct{}, pulse func(), out chan<- int) error {
+		for {
+			pulse()
+			select {
+			case <-wardDone:
+				return nil
+			case out <- 1:
+			}
+		}
+	})
+	<-s.Out()
+	close(done)
+	collect(s.Out())
+	checkNoLeak(t, before)
+}
@@ -0,0 +1,57 @@
+// Package pipelinetest 使用心跳测试长时间运行的 stage 的辅助函数
+// 测试不再依赖 time.Sleep 猜测 stage 需要多长时间：只要 stage 还在发出心跳，
+// 测试就会继续等待；心跳和结果都停止超过 timeout 时，测试才会失败。
+package pipelinetest
+
+import (
+	"testing"
+	"time"
+)
+
+// AwaitBeat 等待一次心跳，用于确认 stage 的 goroutine 已经开始工作
+func AwaitBeat(t testing.TB, heartbeat <-chan struct{}, timeout time.Duration) {
+	t.Helper()
+	select {
+	case _, ok := <-heartbeat:
+		if !ok {
+			t.Fatal("heartbeat channel closed before the first beat")
+		}
+	case <-time.After(timeout):
+		t.Fatalf("no heartbeat within %v", timeout)
+	}
+}
+
+// Receive 从 results 中读取 n 个值
+// 每次收到心跳或者结果都会重新计时，超过 timeout 既没有心跳也没有结果时测试失败，
+// results 在读到 n 个值之前关闭时测试同样失败。
+func Receive[T any](t testing.TB, heartbeat <-chan struct{}, results <-chan T, n int, timeout time.Duration) []T {
+	t.Helper()
+	values := make([]T, 0, n)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for len(values) < n {
+		select {
+		case _, ok := <-heartbeat:
+			if !ok {
+				heartbeat = nil // stage 已经退出，只剩下还没有读取的结果
+			}
+		case v, ok := <-results:
+			if !ok {
+				t.Fatalf("results closed after %d of %d values", len(values), n)
+			}
+			values = append(values, v)
+		case <-timer.C:
+			t.Fatalf("no heartbeat or result within %v, got %d of %d values", timeout, len(values), n)
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(timeout)
+	}
+	return values
+}
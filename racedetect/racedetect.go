@@ -0,0 +1,279 @@
+// Package racedetect 基于向量时钟的 happens-before 数据竞争检测
+// 第一章的竞争条件只能依靠 go test -race 发现，它无法嵌入到我们自己的工具中，
+// 也无法在测试中断言“这种访问方式有竞争”或者“这种访问方式已经正确同步”。
+//
+// 本包只检查显式插桩的共享变量 Var，同步只通过本包提供的 Mutex、Chan、WaitGroup 和 Int64 建立：
+// 每个 goroutine 有一个向量时钟，释放（Unlock、Send、Done、原子写）把自己的时钟交给同步对象，
+// 获取（Lock、Recv、Wait、原子读）把同步对象的时钟合并进自己的时钟。
+// 两次访问同一个 Var，至少有一个是写，并且没有 happens-before 关系时，就是一次数据竞争。
+// 和 -race 一样，只要这两次访问在某一次运行中都发生了，不需要真的同时发生也能发现。
+//
+// 新的 goroutine 需要通过 Detector.Go 启动，才能继承父 goroutine 的时钟；
+// 直接使用 go 语句启动的 goroutine 和其他 goroutine 之间没有 happens-before 关系。
+package racedetect
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"concurrency_in_go/internal/goid"
+)
+
+// Access 一次对 Var 的访问
+type Access struct {
+	Goroutine string
+	Write     bool
+	Stack     []uintptr
+}
+
+func (a Access) String() string {
+	op := "read"
+	if a.Write {
+		op = "write"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s by %s:\n", op, a.Goroutine)
+	frames := runtime.CallersFrames(a.Stack)
+	for {
+		f, more := frames.Next()
+		fmt.Fprintf(&b, "  %s\n      %s:%d\n", f.Function, f.File, f.Line)
+		if !more {
+			return b.String()
+		}
+	}
+}
+
+// Race 一次数据竞争：两次访问之间没有 happens-before 关系
+type Race struct {
+	Var      string
+	Previous Access
+	Current  Access
+}
+
+func (r *Race) String() string {
+	return fmt.Sprintf("racedetect: data race on %s\n\n%v\nprevious %v", r.Var, r.Current, r.Previous)
+}
+
+// Detector 记录每个 goroutine 的向量时钟和发现的数据竞争，可以有多个相互独立的 Detector
+type Detector struct {
+	onRace func(*Race)
+
+	mu       sync.Mutex
+	threads  map[int64]*thread
+	names    []string // 按照 tid 排列的 goroutine 名字
+	reported map[[2]uintptr]bool
+	races    []*Race
+}
+
+// NewDetector 返回一个新的 Detector，每个数据竞争第一次出现时调用 onRace
+// 同一对代码位置之间的竞争只报告一次。onRace 为 nil 时使用 log 打印。
+func NewDetector(onRace func(*Race)) *Detector {
+	if onRace == nil {
+		onRace = func(r *Race) { log.Print(r) }
+	}
+	return &Detector{
+		onRace:   onRace,
+		threads:  make(map[int64]*thread),
+		reported: make(map[[2]uintptr]bool),
+	}
+}
+
+// Races 返回到目前为止发现的所有数据竞争
+func (d *Detector) Races() []*Race {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]*Race(nil), d.races...)
+}
+
+// Go 启动一个名为 name 的 goroutine，go 语句之前的所有操作 happens-before fn
+func (d *Detector) Go(name string, fn func()) {
+	d.mu.Lock()
+	parent := d.current()
+	clock := parent.clock.clone()
+	parent.tick()
+	d.mu.Unlock()
+
+	go func() {
+		d.mu.Lock()
+		t := d.newThread(goid.Get(), name)
+		t.clock.join(clock)
+		d.mu.Unlock()
+		fn()
+	}()
+}
+
+// thread 一个 goroutine 的向量时钟
+type thread struct {
+	id    int
+	clock vectorClock
+}
+
+func (t *thread) tick() {
+	t.clock[t.id]++
+}
+
+// current 返回当前 goroutine 的 thread，第一次出现时创建，调用者持有 d.mu
+func (d *Detector) current() *thread {
+	gid := goid.Get()
+	if t, ok := d.threads[gid]; ok {
+		return t
+	}
+	return d.newThread(gid, "goroutine "+strconv.FormatInt(gid, 10))
+}
+
+func (d *Detector) newThread(gid int64, name string) *thread {
+	t := &thread{id: len(d.names)}
+	t.clock = make(vectorClock, t.id+1)
+	t.clock[t.id] = 1
+	d.names = append(d.names, name)
+	d.threads[gid] = t
+	return t
+}
+
+// acquire 合并同步对象的时钟，调用者持有 d.mu
+func (d *Detector) acquire(c vectorClock) {
+	d.current().clock.join(c)
+}
+
+// release 把当前 goroutine 的时钟合并进同步对象的时钟，调用者持有 d.mu
+func (d *Detector) release(c *vectorClock) {
+	t := d.current()
+	c.join(t.clock)
+	t.tick()
+}
+
+// vectorClock 按照 tid 排列的逻辑时钟
+type vectorClock []uint64
+
+func (c vectorClock) clone() vectorClock {
+	return append(vectorClock(nil), c...)
+}
+
+func (c *vectorClock) join(other vectorClock) {
+	for len(*c) < len(other) {
+		*c = append(*c, 0)
+	}
+	for i, v := range other {
+		(*c)[i] = max((*c)[i], v)
+	}
+}
+
+func (c vectorClock) get(tid int) uint64 {
+	if tid < len(c) {
+		return c[tid]
+	}
+	return 0
+}
+
+// epoch 一次访问发生时访问者的逻辑时间
+type epoch struct {
+	tid   int
+	clock uint64
+	stack []uintptr
+}
+
+// happensBefore 这次访问是否 happens-before 时钟为 c 的 goroutine 的当前时刻
+func (e epoch) happensBefore(c vectorClock) bool {
+	return e.clock <= c.get(e.tid)
+}
+
+// Var 插桩的共享变量，每次访问都由 Detector 检查
+type Var[T any] struct {
+	d     *Detector
+	name  string
+	value T
+
+	write *epoch        // 最后一次写
+	reads map[int]epoch // 最后一次写之后每个 goroutine 的最后一次读
+}
+
+// NewVar 返回由 d 检查、名为 name、初始值为 value 的 Var，初始值不算一次写
+func NewVar[T any](d *Detector, name string, value T) *Var[T] {
+	return &Var[T]{d: d, name: name, value: value}
+}
+
+// Load 读取变量，和之前没有 happens-before 关系的写构成竞争
+func (v *Var[T]) Load() T {
+	d := v.d
+	d.mu.Lock()
+	t := d.current()
+	e := epoch{tid: t.id, clock: t.clock[t.id], stack: callers()}
+	var found []*Race
+	if w := v.write; w != nil && w.tid != t.id && !w.happensBefore(t.clock) {
+		found = d.report(found, v.name, *w, true, e, false)
+	}
+	if v.reads == nil {
+		v.reads = make(map[int]epoch)
+	}
+	v.reads[t.id] = e
+	value := v.value
+	d.mu.Unlock()
+
+	d.notify(found)
+	return value
+}
+
+// Store 写入变量，和之前没有 happens-before 关系的读或者写构成竞争
+func (v *Var[T]) Store(value T) {
+	d := v.d
+	d.mu.Lock()
+	t := d.current()
+	e := epoch{tid: t.id, clock: t.clock[t.id], stack: callers()}
+	var found []*Race
+	if w := v.write; w != nil && w.tid != t.id && !w.happensBefore(t.clock) {
+		found = d.report(found, v.name, *w, true, e, true)
+	}
+	for _, r := range v.reads {
+		if r.tid != t.id && !r.happensBefore(t.clock) {
+			found = d.report(found, v.name, r, false, e, true)
+		}
+	}
+	// 之后和这些读竞争的访问一定也和这次写竞争，不需要再记录它们
+	v.write, v.reads = &e, nil
+	v.value = value
+	d.mu.Unlock()
+
+	d.notify(found)
+}
+
+// report 记录一次竞争，同一对代码位置只记录一次，调用者持有 d.mu
+func (d *Detector) report(found []*Race, name string, prev epoch, prevWrite bool, cur epoch, curWrite bool) []*Race {
+	key := [2]uintptr{site(prev.stack), site(cur.stack)}
+	if d.reported[key] {
+		return found
+	}
+	d.reported[key] = true
+	d.reported[[2]uintptr{key[1], key[0]}] = true
+	r := &Race{
+		Var:      name,
+		Previous: Access{Goroutine: d.names[prev.tid], Write: prevWrite, Stack: prev.stack},
+		Current:  Access{Goroutine: d.names[cur.tid], Write: curWrite, Stack: cur.stack},
+	}
+	d.races = append(d.races, r)
+	return append(found, r)
+}
+
+// notify 不持有 d.mu 时调用 onRace，onRace 中可以使用其他插桩的对象
+func (d *Detector) notify(found []*Race) {
+	for _, r := range found {
+		d.onRace(r)
+	}
+}
+
+// callers 返回访问者的调用栈，跳过 racedetect 内部的栈帧
+func callers() []uintptr {
+	pcs := make([]uintptr, 16)
+	return pcs[:runtime.Callers(3, pcs)]
+}
+
+// site 访问发生的代码位置
+func site(stack []uintptr) uintptr {
+	if len(stack) == 0 {
+		return 0
+	}
+	return stack[0]
+}
@@ -0,0 +1,201 @@
+package racedetect
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+/*
+go test ./racedetect -v -count=1 -run TestRace
+*/
+// TestRace 只通过 sync.WaitGroup 同步的访问没有被插桩，报告写和读之间的竞争
+func TestRace(t *testing.T) {
+	d := NewDetector(func(*Race) {})
+	data := NewVar(d, "data", 0)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	d.Go("writer", func() {
+		defer wg.Done()
+		data.Store(1)
+	})
+	wg.Wait()
+	_ = data.Load()
+
+	races := d.Races()
+	if len(races) != 1 {
+		t.Fatalf("got %d races, want 1", len(races))
+	}
+	r := races[0]
+	if r.Var != "data" || r.Previous.Goroutine != "writer" || !r.Previous.Write || r.Current.Write {
+		t.Fatalf("got %v", r)
+	}
+	if !strings.Contains(r.String(), "TestRace") {
+		t.Fatalf("stack missing from report:\n%v", r)
+	}
+}
+
+/*
+go test ./racedetect -v -count=1 -run TestReportedOnce
+*/
+// TestReportedOnce 同一对代码位置之间的竞争只报告一次，写和之前的读也构成竞争
+func TestReportedOnce(t *testing.T) {
+	var reported []*Race
+	d := NewDetector(func(r *Race) { reported = append(reported, r) })
+	data := NewVar(d, "data", 0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		d.Go("reader", func() {
+			defer wg.Done()
+			_ = data.Load()
+		})
+		wg.Wait()
+		data.Store(i)
+	}
+	if len(reported) != 1 || reported[0].Previous.Write || !reported[0].Current.Write {
+		t.Fatalf("got %v", reported)
+	}
+}
+
+/*
+go test ./racedetect -v -count=1 -run TestSynchronized
+*/
+// TestSynchronized 通过插桩的同步原语建立 happens-before 关系之后没有竞争
+func TestSynchronized(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(d *Detector, data *Var[int])
+	}{
+		{"go", func(d *Detector, data *Var[int]) {
+			data.Store(1)
+			done := make(chan struct{})
+			d.Go("reader", func() {
+				defer close(done)
+				_ = data.Load()
+			})
+			<-done
+		}},
+		{"mutex", func(d *Detector, data *Var[int]) {
+			m := d.NewMutex()
+			var wg sync.WaitGroup
+			wg.Add(1)
+			d.Go("writer", func() {
+				defer wg.Done()
+				m.Lock()
+				data.Store(1)
+				m.Unlock()
+			})
+			wg.Wait()
+			m.Lock()
+			_ = data.Load()
+			m.Unlock()
+		}},
+		{"chan", func(d *Detector, data *Var[int]) {
+			c := NewChan[int](d, 1)
+			d.Go("writer", func() {
+				data.Store(1)
+				c.Send(1)
+			})
+			c.Recv()
+			data.Store(2)
+		}},
+		{"unbuffered chan", func(d *Detector, data *Var[int]) {
+			c := NewChan[int](d, 0)
+			done := NewChan[int](d, 0)
+			d.Go("reader", func() {
+				c.Recv()
+				_ = data.Load() // 接收之前的写被接收者看到
+				done.Close()
+			})
+			c.Send(1)
+			done.Recv()
+			data.Store(1)
+		}},
+		{"close", func(d *Detector, data *Var[int]) {
+			c := NewChan[int](d, 0)
+			d.Go("writer", func() {
+				data.Store(1)
+				c.Close()
+			})
+			if _, ok := c.Recv(); ok {
+				panic("channel not closed")
+			}
+			_ = data.Load()
+		}},
+		{"waitgroup", func(d *Detector, data *Var[int]) {
+			wg := d.NewWaitGroup()
+			wg.Add(2)
+			for i := 0; i < 2; i++ {
+				d.Go("reader", func() {
+					defer wg.Done()
+					_ = data.Load()
+				})
+			}
+			wg.Wait()
+			data.Store(1)
+		}},
+		{"atomic", func(d *Detector, data *Var[int]) {
+			ready := d.NewInt64()
+			d.Go("writer", func() {
+				data.Store(1)
+				ready.Store(1)
+			})
+			for ready.Load() == 0 {
+			}
+			_ = data.Load()
+		}},
+		{"semaphore", func(d *Detector, data *Var[int]) {
+			sem := NewChan[int](d, 1) // Send 获取，Recv 释放
+			wg := d.NewWaitGroup()
+			wg.Add(2)
+			for i := 0; i < 2; i++ {
+				d.Go("worker", func() {
+					defer wg.Done()
+					sem.Send(0)
+					data.Store(data.Load() + 1)
+					sem.Recv()
+				})
+			}
+			wg.Wait()
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDetector(func(*Race) {})
+			tt.run(d, NewVar(d, "data", 0))
+			if races := d.Races(); len(races) != 0 {
+				t.Fatalf("got %v", races)
+			}
+		})
+	}
+}
+
+/*
+go test ./racedetect -v -count=1 -run TestAtomicCounter
+*/
+// TestAtomicCounter 原子计数本身不是竞争，但是只通过计数“同步”的普通写仍然和读竞争
+func TestAtomicCounter(t *testing.T) {
+	d := NewDetector(func(*Race) {})
+	count := d.NewInt64()
+	data := NewVar(d, "data", 0)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	for i := 0; i < 2; i++ {
+		d.Go("worker", func() {
+			defer wg.Done()
+			count.Add(1)
+			data.Store(1)
+		})
+	}
+	wg.Wait()
+	if count.Load() != 2 {
+		t.Fatalf("count %d", count.Load())
+	}
+	if races := d.Races(); len(races) != 1 || races[0].Var != "data" {
+		t.Fatalf("got %v", races)
+	}
+}
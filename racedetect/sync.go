@@ -0,0 +1,203 @@
+package racedetect
+
+import "sync"
+
+// Mutex 插桩的互斥锁，实现了 sync.Locker
+// Unlock happens-before 之后的 Lock。
+type Mutex struct {
+	d     *Detector
+	mu    sync.Mutex
+	clock vectorClock
+}
+
+var _ sync.Locker = (*Mutex)(nil)
+
+// NewMutex 返回由 d 记录同步的 Mutex
+func (d *Detector) NewMutex() *Mutex {
+	return &Mutex{d: d}
+}
+
+// Lock 获取锁
+func (m *Mutex) Lock() {
+	m.mu.Lock()
+	m.d.mu.Lock()
+	m.d.acquire(m.clock)
+	m.d.mu.Unlock()
+}
+
+// Unlock 释放锁
+func (m *Mutex) Unlock() {
+	m.d.mu.Lock()
+	m.d.release(&m.clock)
+	m.d.mu.Unlock()
+	m.mu.Unlock()
+}
+
+// Chan 插桩的 channel
+// Send happens-before 对应的 Recv 完成；没有缓冲区时，Recv 也 happens-before 对应的 Send 完成；
+// 有缓冲区时，第 k 次 Recv happens-before 第 k+cap 次 Send 完成，所以可以当作信号量使用；
+// Close happens-before 因为 channel 关闭而返回的 Recv。
+type Chan[T any] struct {
+	d      *Detector
+	ch     chan message[T]
+	closed vectorClock
+
+	// slots 有缓冲区时的空位，和缓冲区一样有 cap 个，组成接收者时钟的环：
+	// Recv 把自己的时钟放回去，Send 取出一个空位并获取其中的时钟之后才能发送
+	slots chan vectorClock
+}
+
+type message[T any] struct {
+	value T
+	clock vectorClock      // 发送者的时钟
+	ack   chan vectorClock // 没有缓冲区时，接收者通过它把自己的时钟交给发送者
+}
+
+// NewChan 返回由 d 记录同步、缓冲区大小为 size 的 Chan
+func NewChan[T any](d *Detector, size int) *Chan[T] {
+	c := &Chan[T]{d: d, ch: make(chan message[T], size), slots: make(chan vectorClock, size)}
+	for i := 0; i < size; i++ {
+		c.slots <- nil // 一开始的空位没有接收者
+	}
+	return c
+}
+
+// Send 发送 value，和 channel 一样可能阻塞
+func (c *Chan[T]) Send(value T) {
+	m := message[T]{value: value}
+	var slot vectorClock
+	if cap(c.ch) == 0 {
+		m.ack = make(chan vectorClock, 1)
+	} else {
+		slot = <-c.slots // 缓冲区满时在这里阻塞，直到有 Recv 放回空位
+	}
+	c.d.mu.Lock()
+	c.d.acquire(slot)
+	t := c.d.current()
+	m.clock = t.clock.clone()
+	t.tick()
+	c.d.mu.Unlock()
+
+	c.ch <- m
+	if m.ack != nil {
+		clock := <-m.ack
+		c.d.mu.Lock()
+		c.d.acquire(clock)
+		c.d.mu.Unlock()
+	}
+}
+
+// Recv 接收一个值，channel 关闭并且没有剩余的值时 ok 为 false
+func (c *Chan[T]) Recv() (value T, ok bool) {
+	m, ok := <-c.ch
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	if !ok {
+		c.d.acquire(c.closed)
+		return value, false
+	}
+	c.d.acquire(m.clock)
+	t := c.d.current()
+	if m.ack != nil {
+		m.ack <- t.clock.clone()
+	} else {
+		c.slots <- t.clock.clone() // 空位的数量不超过 cap，不会阻塞
+	}
+	t.tick()
+	return m.value, true
+}
+
+// Close 关闭 channel
+func (c *Chan[T]) Close() {
+	c.d.mu.Lock()
+	c.d.release(&c.closed)
+	c.d.mu.Unlock()
+	close(c.ch)
+}
+
+// WaitGroup 插桩的 WaitGroup
+// 每一次 Done happens-before 因为它而返回的 Wait。
+type WaitGroup struct {
+	d     *Detector
+	wg    sync.WaitGroup
+	clock vectorClock
+}
+
+// NewWaitGroup 返回由 d 记录同步的 WaitGroup
+func (d *Detector) NewWaitGroup() *WaitGroup {
+	return &WaitGroup{d: d}
+}
+
+// Add 和 sync.WaitGroup 一样
+func (wg *WaitGroup) Add(delta int) {
+	wg.wg.Add(delta)
+}
+
+// Done 计数减一
+func (wg *WaitGroup) Done() {
+	wg.d.mu.Lock()
+	wg.d.release(&wg.clock)
+	wg.d.mu.Unlock()
+	wg.wg.Done()
+}
+
+// Wait 阻塞直到计数为 0
+func (wg *WaitGroup) Wait() {
+	wg.wg.Wait()
+	wg.d.mu.Lock()
+	wg.d.acquire(wg.clock)
+	wg.d.mu.Unlock()
+}
+
+// Int64 插桩的原子整数
+// 和 Go 内存模型一样，一次原子操作的结果被另一次原子操作观察到时，前者 happens-before 后者：
+// 写（Store、Add、成功的 CompareAndSwap）是释放，读（Load、Add、CompareAndSwap）是获取。
+type Int64 struct {
+	d     *Detector
+	value int64 // 只在持有 d.mu 时访问
+	clock vectorClock
+}
+
+// NewInt64 返回由 d 记录同步的 Int64
+func (d *Detector) NewInt64() *Int64 {
+	return &Int64{d: d}
+}
+
+// Load 原子地读取
+func (i *Int64) Load() int64 {
+	i.d.mu.Lock()
+	defer i.d.mu.Unlock()
+	i.d.acquire(i.clock)
+	return i.value
+}
+
+// Store 原子地写入
+func (i *Int64) Store(value int64) {
+	i.d.mu.Lock()
+	defer i.d.mu.Unlock()
+	i.d.release(&i.clock)
+	i.value = value
+}
+
+// Add 原子地加上 delta，返回新的值
+func (i *Int64) Add(delta int64) int64 {
+	i.d.mu.Lock()
+	defer i.d.mu.Unlock()
+	i.d.acquire(i.clock)
+	i.d.release(&i.clock)
+	i.value += delta
+	return i.value
+}
+
+// CompareAndSwap 值为 old 时原子地替换为 new
+func (i *Int64) CompareAndSwap(old, new int64) bool {
+	i.d.mu.Lock()
+	defer i.d.mu.Unlock()
+	i.d.acquire(i.clock)
+	if i.value != old {
+		return false
+	}
+	i.d.release(&i.clock)
+	i.value = new
+	return true
+}
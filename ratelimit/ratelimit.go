@@ -0,0 +1,214 @@
+// Package ratelimit 基于令牌桶的速率限制
+// 第五章速率限制一节的实现：令牌桶 TokenBucket、
+// 组合多个限制的 Multi（例如每秒、每分钟以及磁盘和网络各自的限制），
+// 以及在 pipeline 中限制数据流速率的 Throttle。
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Limit 每秒允许的事件数
+type Limit float64
+
+// Inf 不限制速率
+const Inf = Limit(math.MaxFloat64)
+
+// Per 在 duration 内允许 eventCount 个事件，例如 Per(10, time.Minute)
+func Per(eventCount int, duration time.Duration) Limit {
+	return Limit(float64(eventCount) / duration.Seconds())
+}
+
+// Every 每隔 interval 允许一个事件
+func Every(interval time.Duration) Limit {
+	if interval <= 0 {
+		return Inf
+	}
+	return Limit(1 / interval.Seconds())
+}
+
+// ErrNeverAllowed 速率或者桶的深度为 0，等待永远不会成功
+var ErrNeverAllowed = errors.New("ratelimit: event would never be allowed")
+
+// ErrExceedsDeadline 需要等待的时间超过了 context 的截止时间
+var ErrExceedsDeadline = errors.New("ratelimit: wait would exceed context deadline")
+
+// Limiter 速率限制器
+// Reserve 是导出的，本包之外的限制器（例如测试中的假实现）也可以交给 Multi 组合。
+type Limiter interface {
+	// Wait 阻塞直到允许一个事件，ctx 取消时返回 ctx.Err()
+	Wait(ctx context.Context) error
+	// Allow 现在是否允许一个事件，不阻塞
+	Allow() bool
+	// Limit 长期的速率
+	Limit() Limit
+
+	// Reserve 在 now 预留一个事件，返回需要等待的时间和取消预留的函数
+	// 需要等待的时间超过 maxDelay 时不预留并返回 ErrExceedsDeadline。
+	Reserve(now time.Time, maxDelay time.Duration) (time.Duration, func(), error)
+}
+
+// TokenBucket 令牌桶
+// 桶中最多有 burst 个令牌，以 limit 的速率补充，每个事件消耗一个令牌。
+// 桶一开始是满的，所以最多允许 burst 个事件同时发生。
+type TokenBucket struct {
+	limit Limit
+	burst int
+
+	mu     sync.Mutex
+	tokens float64   // 可能为负数，表示已经被等待中的事件预留
+	last   time.Time // 上一次补充令牌的时间
+}
+
+// NewTokenBucket 返回速率为 limit、深度为 burst 的令牌桶
+func NewTokenBucket(limit Limit, burst int) *TokenBucket {
+	return &TokenBucket{limit: limit, burst: burst, tokens: float64(burst)}
+}
+
+// Limit 返回令牌补充的速率
+func (b *TokenBucket) Limit() Limit {
+	return b.limit
+}
+
+// Burst 返回桶的深度
+func (b *TokenBucket) Burst() int {
+	return b.burst
+}
+
+// Allow 桶中有令牌时消耗一个并返回 true
+func (b *TokenBucket) Allow() bool {
+	_, _, err := b.Reserve(time.Now(), 0)
+	return err == nil
+}
+
+// Wait 等待一个令牌
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	return wait(ctx, b)
+}
+
+// Reserve 预留一个令牌，取消时归还令牌
+func (b *TokenBucket) Reserve(now time.Time, maxDelay time.Duration) (time.Duration, func(), error) {
+	if b.limit == Inf {
+		return 0, func() {}, nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.burst < 1 || b.limit <= 0 && b.tokens < 1 {
+		return 0, nil, ErrNeverAllowed
+	}
+
+	if !b.last.IsZero() && now.After(b.last) {
+		b.tokens = math.Min(b.tokens+now.Sub(b.last).Seconds()*float64(b.limit), float64(b.burst))
+	}
+	if now.After(b.last) {
+		b.last = now
+	}
+
+	var delay time.Duration
+	if tokens := b.tokens - 1; tokens < 0 {
+		delay = time.Duration(-tokens / float64(b.limit) * float64(time.Second))
+	}
+	if delay > maxDelay {
+		return 0, nil, ErrExceedsDeadline
+	}
+	b.tokens--
+
+	cancel := func() { // 归还令牌
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.tokens = math.Min(b.tokens+1, float64(b.burst))
+	}
+	return delay, cancel, nil
+}
+
+// multiLimiter 组合多个 Limiter
+type multiLimiter struct {
+	limiters []Limiter
+}
+
+// Multi 组合多个 Limiter，每个事件需要同时得到所有 Limiter 的允许
+// 例如 Multi(perSecond, perMinute) 同时限制短时间的突发和长时间的总量。
+// Multi 的结果也是 Limiter，可以继续和其他 Limiter 组合，
+// 例如 Multi(apiLimit, diskLimit) 和 Multi(apiLimit, networkLimit) 共享 apiLimit。
+func Multi(limiters ...Limiter) Limiter {
+	limiters = append([]Limiter(nil), limiters...)
+	sort.SliceStable(limiters, func(i, j int) bool { // 最严格的限制排在前面
+		return limiters[i].Limit() < limiters[j].Limit()
+	})
+	return &multiLimiter{limiters: limiters}
+}
+
+// Limit 返回最严格的速率
+func (m *multiLimiter) Limit() Limit {
+	if len(m.limiters) == 0 {
+		return Inf
+	}
+	return m.limiters[0].Limit()
+}
+
+func (m *multiLimiter) Allow() bool {
+	_, _, err := m.Reserve(time.Now(), 0)
+	return err == nil
+}
+
+func (m *multiLimiter) Wait(ctx context.Context) error {
+	return wait(ctx, m)
+}
+
+// Reserve 在所有 Limiter 中预留，任意一个失败时归还已经预留的令牌
+// 需要等待的时间是所有 Limiter 中最长的。
+func (m *multiLimiter) Reserve(now time.Time, maxDelay time.Duration) (time.Duration, func(), error) {
+	var delay time.Duration
+	cancels := make([]func(), 0, len(m.limiters))
+	cancel := func() {
+		for _, c := range cancels {
+			c()
+		}
+	}
+	for _, l := range m.limiters {
+		d, c, err := l.Reserve(now, maxDelay)
+		if err != nil {
+			cancel()
+			return 0, nil, err
+		}
+		cancels = append(cancels, c)
+		delay = max(delay, d)
+	}
+	return delay, cancel, nil
+}
+
+// wait 预留一个事件并等待，ctx 在等待期间取消时归还令牌
+func wait(ctx context.Context, l Limiter) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	maxDelay := time.Duration(math.MaxInt64)
+	if deadline, ok := ctx.Deadline(); ok {
+		maxDelay = deadline.Sub(now)
+	}
+	delay, cancel, err := l.Reserve(now, maxDelay)
+	if err != nil {
+		return err
+	}
+	if delay == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		cancel()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
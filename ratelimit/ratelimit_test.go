@@ -0,0 +1,200 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+
+	"concurrency_in_go/pipeline"
+)
+
+/*
+go test ./ratelimit -v -count=1 -run TestTokenBucketAllow
+*/
+func TestTokenBucketAllow(t *testing.T) {
+	b := NewTokenBucket(Every(time.Hour), 3)
+	for i := 0; i < 3; i++ {
+		if !b.Allow() {
+			t.Fatalf("event %d denied, want the first 3 allowed", i)
+		}
+	}
+	if b.Allow() {
+		t.Fatal("4th event allowed, want denied")
+	}
+	if !NewTokenBucket(Inf, 0).Allow() {
+		t.Fatal("Inf limit denied an event")
+	}
+}
+
+/*
+go test ./ratelimit -v -count=1 -run TestTokenBucketWait
+*/
+func TestTokenBucketWait(t *testing.T) {
+	b := NewTokenBucket(Per(100, time.Second), 1)
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := b.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 第一个事件使用桶中的令牌，其余 4 个每个等待 10ms，理论上至少需要 40ms，留出 5ms 的计时误差
+	if elapsed := time.Since(start); elapsed < 35*time.Millisecond {
+		t.Fatalf("5 events took %v, want at least 35ms", elapsed)
+	}
+}
+
+/*
+go test ./ratelimit -v -count=1 -run TestWaitErrors
+*/
+func TestWaitErrors(t *testing.T) {
+	if err := NewTokenBucket(0, 0).Wait(context.Background()); !errors.Is(err, ErrNeverAllowed) {
+		t.Fatalf("got %v, want ErrNeverAllowed", err)
+	}
+
+	b := NewTokenBucket(Every(time.Hour), 1)
+	b.Allow()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := b.Wait(ctx); !errors.Is(err, ErrExceedsDeadline) {
+		t.Fatalf("got %v, want ErrExceedsDeadline", err)
+	}
+
+	// 等待被取消时归还预留的令牌
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if err := b.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 0 {
+		t.Fatalf("tokens %v after canceled wait, want the reservation returned", b.tokens)
+	}
+}
+
+/*
+go test ./ratelimit -v -count=1 -run TestMulti
+*/
+func TestMulti(t *testing.T) {
+	perSecond := NewTokenBucket(Per(2, time.Second), 2)
+	perMinute := NewTokenBucket(Per(10, time.Minute), 1)
+	m := Multi(perSecond, perMinute)
+	if m.Limit() != perMinute.Limit() {
+		t.Fatalf("limit %v, want the strictest %v", m.Limit(), perMinute.Limit())
+	}
+
+	if !m.Allow() {
+		t.Fatal("first event denied")
+	}
+	// perMinute 已经没有令牌，perSecond 的令牌不能被消耗
+	if m.Allow() {
+		t.Fatal("second event allowed, want denied by perMinute")
+	}
+	if !perSecond.Allow() {
+		t.Fatal("perSecond lost a token to a denied event")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := m.Wait(ctx); !errors.Is(err, ErrExceedsDeadline) {
+		t.Fatalf("got %v, want ErrExceedsDeadline", err)
+	}
+}
+
+// fakeLimiter 本包之外也可以写出的 Limiter，用来检查 Multi 对其他实现的组合
+type fakeLimiter struct {
+	limit    Limit
+	delay    time.Duration
+	reserved int
+}
+
+func (f *fakeLimiter) Wait(context.Context) error { return nil }
+func (f *fakeLimiter) Allow() bool                { return true }
+func (f *fakeLimiter) Limit() Limit               { return f.limit }
+
+func (f *fakeLimiter) Reserve(_ time.Time, maxDelay time.Duration) (time.Duration, func(), error) {
+	if f.delay > maxDelay {
+		return 0, nil, ErrExceedsDeadline
+	}
+	f.reserved++
+	return f.delay, func() { f.reserved-- }, nil
+}
+
+/*
+go test ./ratelimit -v -count=1 -run TestMultiFake
+*/
+func TestMultiFake(t *testing.T) {
+	bucket := NewTokenBucket(Every(time.Hour), 1)
+	fake := &fakeLimiter{limit: 1, delay: 20 * time.Millisecond}
+
+	// bucket 的速率更低，先在 bucket 中预留；
+	// fake 需要等待 20ms，超过了 Allow 允许的 0，bucket 的令牌要被归还
+	if Multi(bucket, fake).Allow() {
+		t.Fatal("event allowed, want denied by fake")
+	}
+	if fake.reserved != 0 || !bucket.Allow() {
+		t.Fatalf("denied event kept a reservation: fake %d", fake.reserved)
+	}
+
+	// fake 的速率更低，先在 fake 中预留；bucket 已经没有令牌，等待失败时要取消在 fake 中的预留
+	fake.limit = 0
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := Multi(bucket, fake).Wait(ctx); !errors.Is(err, ErrExceedsDeadline) || fake.reserved != 0 {
+		t.Fatalf("got %v with %d reservations, want ErrExceedsDeadline and none", err, fake.reserved)
+	}
+
+	start := time.Now()
+	if err := Multi(NewTokenBucket(Inf, 1), fake).Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 15*time.Millisecond {
+		t.Fatalf("waited %v, want the fake's 20ms", elapsed)
+	}
+}
+
+/*
+go test ./ratelimit -v -count=1 -run TestThrottle
+*/
+func TestThrottle(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	start := time.Now()
+	var got []int
+	for v := range Throttle(done, pipeline.Generator(done, 1, 2, 3, 4, 5), NewTokenBucket(Per(100, time.Second), 1)) {
+		got = append(got, v)
+	}
+	if !reflect.DeepEqual(got, []int{1, 2, 3, 4, 5}) {
+		t.Fatalf("got %v, want [1 2 3 4 5]", got)
+	}
+	// 和 TestTokenBucketWait 一样，理论上至少需要 40ms，留出 5ms 的计时误差
+	if elapsed := time.Since(start); elapsed < 35*time.Millisecond {
+		t.Fatalf("throttled stream took %v, want at least 35ms", elapsed)
+	}
+}
+
+/*
+go test ./ratelimit -v -count=1 -run TestThrottleCancel
+*/
+// TestThrottleCancel 关闭 done 时，正在等待令牌的 Throttle 也要退出
+func TestThrottleCancel(t *testing.T) {
+	before := runtime.NumGoroutine()
+	done := make(chan struct{})
+	throttled := Throttle(done, pipeline.Repeat(done, 1), NewTokenBucket(Every(time.Hour), 1))
+	<-throttled
+	close(done)
+	for range throttled {
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("goroutine leak: %d before, %d after", before, runtime.NumGoroutine())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,39 @@
+package ratelimit
+
+import (
+	"context"
+
+	"concurrency_in_go/pipeline"
+)
+
+// Throttle 限制数据流的速率的 pipeline stage
+// 每个值发送之前都需要等待 l 的允许，done 关闭后停止并关闭返回的 channel。
+// l 永远不会允许事件时（ErrNeverAllowed）返回的 channel 直接被关闭。
+// l 可以和其他 stage 或者 goroutine 共享，这时它们一起受到同一个速率的限制。
+func Throttle[T any](done <-chan struct{}, valueStream <-chan T, l Limiter) <-chan T {
+	ctx, cancel := context.WithCancel(context.Background())
+	throttled := make(chan T)
+	go func() {
+		defer close(throttled)
+		defer cancel()
+		go func() { // done 关闭时取消正在进行的等待
+			select {
+			case <-done:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		for v := range pipeline.OrDone(done, valueStream) {
+			if err := l.Wait(ctx); err != nil {
+				return
+			}
+			select {
+			case <-done:
+				return
+			case throttled <- v:
+			}
+		}
+	}()
+	return throttled
+}
@@ -0,0 +1,108 @@
+package sched
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Explore 依次使用种子 1 到 seeds 随机地探索 body 的交错执行
+// 返回第一次失败的结果，使用 Replay 可以精确地重现它；所有种子都成功时 ok 为 true。
+func Explore(seeds int, body func(s *Scheduler)) (failed Result, ok bool) {
+	for seed := int64(1); seed <= int64(seeds); seed++ {
+		if r := Run(Config{Seed: seed}, body); r.Failed() {
+			return r, false
+		}
+	}
+	return Result{}, true
+}
+
+// Replay 按照 r 的调度序列重新运行 body，得到和 r 相同的交错执行
+func Replay(r Result, body func(s *Scheduler)) Result {
+	schedule := r.Schedule
+	if schedule == nil {
+		schedule = []int{}
+	}
+	return Run(Config{Seed: r.Seed, Schedule: schedule}, body)
+}
+
+// Enumerate 深度优先地枚举 body 所有的交错执行，对每一次运行的结果调用 visit
+// visit 返回 false 或者运行次数达到 limit（limit 小于 1 表示不限制）时停止，返回运行的次数。
+func Enumerate(limit int, body func(s *Scheduler), visit func(Result) bool) int {
+	runs, _ := enumerate(Config{}, -1, limit, body, visit)
+	return runs
+}
+
+// enumerate 每次运行按照一个调度序列的前缀重放，之后总是选择 0，即不抢占；
+// 然后把最后一个还有其他选择的调度点换成下一个选择，直到所有选择都被尝试过。
+// preemptions 不小于 0 时，跳过抢占次数超过 preemptions 的选择。
+// 所有的交错执行都被尝试过时 complete 为 true。
+func enumerate(cfg Config, preemptions, limit int, body func(s *Scheduler), visit func(Result) bool) (runs int, complete bool) {
+	cfg.Schedule = []int{}
+	for runs = 1; ; runs++ {
+		s := run(cfg, body)
+		if !visit(s.result()) || runs == limit {
+			return runs, false
+		}
+
+		used := s.preemptions // 调度点 i 之前的抢占次数
+		i := len(s.schedule) - 1
+		for ; i >= 0; i-- {
+			if s.schedule[i] != 0 && s.preemptible[i] {
+				used--
+			}
+			next := s.schedule[i] + 1
+			if next < s.widths[i] && (preemptions < 0 || !s.preemptible[i] || used < preemptions) {
+				break
+			}
+		}
+		if i < 0 {
+			return runs, true
+		}
+		cfg.Schedule = append(s.schedule[:i:i], s.schedule[i]+1)
+	}
+}
+
+// CheckConfig Check 的配置
+type CheckConfig struct {
+	// Preemptions 每次运行最多的抢占次数，小于 0 表示不限制
+	// 为 0 时只在虚拟 goroutine 阻塞或者结束时切换。大多数并发错误只需要很少的抢占就能出现。
+	Preemptions int
+	MaxRuns     int // 最多运行的次数，0 表示不限制
+	MaxSteps    int // 每次运行的步数上限，0 表示 DefaultMaxSteps
+}
+
+// Report Check 的结果
+type Report struct {
+	Runs     int
+	Complete bool     // 是否尝试了抢占次数上限内所有的交错执行
+	Failures []Result // 每一种不同的失败第一次出现的运行，按照发现的顺序
+}
+
+// Failed 是否有失败
+func (r Report) Failed() bool {
+	return len(r.Failures) > 0
+}
+
+func (r Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d runs, complete %v, %d failures", r.Runs, r.Complete, len(r.Failures))
+	for _, f := range r.Failures {
+		fmt.Fprintf(&b, "\n\n%v", f)
+	}
+	return b.String()
+}
+
+// Check 在抢占次数的上限内系统地枚举 body 的交错执行
+// 报告断言失败、panic、死锁、数据竞争以及超过步数上限的运行，每一种失败都附带可以用 Replay 重现的调度序列。
+func Check(cfg CheckConfig, body func(s *Scheduler)) Report {
+	var report Report
+	seen := make(map[string]bool)
+	report.Runs, report.Complete = enumerate(Config{MaxSteps: cfg.MaxSteps}, cfg.Preemptions, cfg.MaxRuns, body, func(r Result) bool {
+		if r.Failed() && !seen[r.Err.Error()] {
+			seen[r.Err.Error()] = true
+			report.Failures = append(report.Failures, r)
+		}
+		return true
+	})
+	return report
+}
@@ -0,0 +1,394 @@
+// Package sched 确定性的并发调度器，用来重现竞争条件
+// 第一章 raceCondCase 每次运行的结果可能都不一样，而且无法重现某一次的交错执行。
+// 本包在一个调度器下运行协作式的“虚拟 goroutine”：同一时刻只有一个虚拟 goroutine 在运行，
+// 它只会在显式的让出点（Yield、Mutex.Lock 等）把执行权交还给调度器，
+// 调度器根据种子或者给定的调度序列选择下一个运行的虚拟 goroutine。
+// 所以相同的种子总是得到相同的交错执行，失败的种子可以被精确地重放。
+//
+// 虚拟 goroutine 中不能使用真实的阻塞操作（channel、sync.Mutex、time.Sleep 等），
+// 它们会让整个调度器停下来；需要同步时使用本包提供的 Mutex 和 WaitGroup，
+// 共享的变量使用 Var，两个虚拟 goroutine 同时将要访问同一个 Var 并且其中一个是写时报告 ErrRace。
+//
+// Check 在抢占次数的上限内枚举所有的交错执行，报告断言失败、死锁和数据竞争以及得到它们的调度序列。
+package sched
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// ErrDeadlock 所有未结束的虚拟 goroutine 都被阻塞
+var ErrDeadlock = errors.New("sched: all goroutines are blocked")
+
+// ErrRace 两个虚拟 goroutine 同时将要访问同一个 Var，并且至少有一个是写
+var ErrRace = errors.New("sched: data race")
+
+// ErrAssertion Assert 的条件不成立
+var ErrAssertion = errors.New("sched: assertion failed")
+
+// ErrStepLimit 调度的步数超过了 Config.MaxSteps，可能存在活锁或者死循环
+var ErrStepLimit = errors.New("sched: step limit exceeded")
+
+// DefaultMaxSteps Config.MaxSteps 为 0 时使用的步数上限
+const DefaultMaxSteps = 10000
+
+// Config 一次运行的配置
+// Schedule 中的每个数是一个有多个虚拟 goroutine 可以运行的调度点的选择：
+// k 表示从上一个运行的虚拟 goroutine 开始，按照启动的顺序循环地数到的第 k 个可以运行的虚拟 goroutine，
+// 所以 0 总是表示继续运行上一个虚拟 goroutine；上一个阻塞或者结束时从第一个可以运行的开始数。
+// 超出 Schedule 长度的调度点都选择 0。
+type Config struct {
+	Seed     int64 // 随机选择下一个虚拟 goroutine 的种子
+	Schedule []int // 不为 nil 时按照这个调度序列重放，忽略 Seed
+	MaxSteps int   // 调度步数的上限，0 表示 DefaultMaxSteps
+}
+
+// Result 一次运行的结果
+type Result struct {
+	Seed        int64
+	Schedule    []int    // 每个有多个选择的调度点的选择，传给 Config.Schedule 可以重放
+	Trace       []string // 每一步运行的虚拟 goroutine 的名字
+	Preemptions int      // 切换走仍然可以运行的虚拟 goroutine 的次数
+	Err         error    // Errorf 报告的错误、panic、ErrDeadlock、ErrRace 或者 ErrStepLimit
+}
+
+// Failed 这次运行是否失败
+func (r Result) Failed() bool {
+	return r.Err != nil
+}
+
+func (r Result) String() string {
+	status := "ok"
+	if r.Err != nil {
+		status = r.Err.Error()
+	}
+	return fmt.Sprintf("seed %d schedule %v (%d preemptions): %s\ntrace: %s",
+		r.Seed, r.Schedule, r.Preemptions, status, strings.Join(r.Trace, " "))
+}
+
+// Scheduler 一次运行中的调度器，只能在虚拟 goroutine 中使用
+type Scheduler struct {
+	seed     int64
+	choose   func(n int) int
+	maxSteps int
+
+	gs       []*goroutine
+	current  *goroutine
+	events   chan struct{} // 正在运行的虚拟 goroutine 让出、阻塞或者结束时发送
+	aborting bool
+	wg       sync.WaitGroup
+
+	schedule    []int  // 每个调度点的选择
+	widths      []int  // 每个调度点可以选择的数量
+	preemptible []bool // 每个调度点上一个运行的虚拟 goroutine 是否仍然可以运行
+	preemptions int
+	trace       []string
+	err         error
+}
+
+type goroutine struct {
+	name   string
+	resume chan bool // true 表示继续运行，false 表示运行被放弃，需要退出
+	done   bool
+	until  func() bool // 不为 nil 时，返回 true 之前不能运行
+	access *access     // 将要访问的 Var
+}
+
+type access struct {
+	v     interface{} // *Var[T]
+	name  string
+	write bool
+}
+
+func (a *access) String() string {
+	if a.write {
+		return "write"
+	}
+	return "read"
+}
+
+// Run 在调度器下运行 body，body 本身是名为 "main" 的虚拟 goroutine
+// 所有虚拟 goroutine 结束、某个虚拟 goroutine 失败或者 panic、发生死锁或者超过步数上限时返回。
+func Run(cfg Config, body func(s *Scheduler)) Result {
+	return run(cfg, body).result()
+}
+
+func run(cfg Config, body func(s *Scheduler)) *Scheduler {
+	if cfg.MaxSteps == 0 {
+		cfg.MaxSteps = DefaultMaxSteps
+	}
+	s := &Scheduler{seed: cfg.Seed, maxSteps: cfg.MaxSteps, events: make(chan struct{})}
+	if cfg.Schedule != nil {
+		step := 0
+		s.choose = func(n int) int {
+			pick := 0
+			if step < len(cfg.Schedule) {
+				pick = cfg.Schedule[step] % n
+			}
+			step++
+			return pick
+		}
+	} else {
+		r := rand.New(rand.NewSource(cfg.Seed))
+		s.choose = r.Intn
+	}
+
+	s.Go("main", func() { body(s) })
+	s.loop()
+	return s
+}
+
+func (s *Scheduler) result() Result {
+	return Result{Seed: s.seed, Schedule: s.schedule, Trace: s.trace, Preemptions: s.preemptions, Err: s.err}
+}
+
+// loop 每一步选择一个可以运行的虚拟 goroutine，运行到它的下一个让出点
+// 选择的编码见 Config，0 总是表示不切换。
+func (s *Scheduler) loop() {
+	defer s.wg.Wait()
+	defer s.abort() // 失败时放弃所有还没有结束的虚拟 goroutine
+
+	for step := 0; s.err == nil; step++ {
+		var runnable []*goroutine
+		pending := false
+		for _, g := range s.gs {
+			if !g.done {
+				pending = true
+				if g.until == nil || g.until() {
+					runnable = append(runnable, g)
+				}
+			}
+		}
+		if !pending {
+			return
+		}
+		if len(runnable) == 0 {
+			s.err = fmt.Errorf("%w: %s", ErrDeadlock, strings.Join(s.blockedNames(), ", "))
+			return
+		}
+		if step >= s.maxSteps {
+			s.err = ErrStepLimit
+			return
+		}
+		if s.err = race(runnable); s.err != nil {
+			return
+		}
+
+		prev := -1
+		for i, g := range runnable {
+			if g == s.current {
+				prev = i
+			}
+		}
+		pick := 0
+		if len(runnable) > 1 {
+			pick = s.choose(len(runnable))
+			s.schedule = append(s.schedule, pick)
+			s.widths = append(s.widths, len(runnable))
+			s.preemptible = append(s.preemptible, prev >= 0)
+			if pick != 0 && prev >= 0 {
+				s.preemptions++
+			}
+		}
+		g := runnable[(max(prev, 0)+pick)%len(runnable)]
+		s.trace = append(s.trace, g.name)
+		s.current = g
+		g.resume <- true
+		<-s.events
+	}
+}
+
+func (s *Scheduler) abort() {
+	s.aborting = true
+	for _, g := range s.gs {
+		if !g.done {
+			g.resume <- false // 一个一个地放弃，它们的 defer 不会同时运行
+			<-s.events
+		}
+	}
+}
+
+// race 检查可以运行的虚拟 goroutine 中是否有两个将要访问同一个 Var，并且至少有一个是写
+// 它们之间没有任何同步，调度器可以任意安排两次访问的顺序。
+func race(runnable []*goroutine) error {
+	for i, g := range runnable {
+		for _, h := range runnable[i+1:] {
+			a, b := g.access, h.access
+			if a != nil && b != nil && a.v == b.v && (a.write || b.write) {
+				return fmt.Errorf("%w on %s: %s by %s and %s by %s", ErrRace, a.name, a, g.name, b, h.name)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) blockedNames() []string {
+	var names []string
+	for _, g := range s.gs {
+		if !g.done && g.until != nil && !g.until() {
+			names = append(names, g.name)
+		}
+	}
+	return names
+}
+
+// Go 启动一个名为 name 的虚拟 goroutine，它在被调度器选中之后才开始运行
+// 和 go 语句一样，调用者继续运行，不会让出。
+func (s *Scheduler) Go(name string, fn func()) {
+	g := &goroutine{name: name, resume: make(chan bool)}
+	s.gs = append(s.gs, g)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() { s.events <- struct{}{} }() // 结束或者被放弃之后通知调度器
+		if !<-g.resume {
+			return
+		}
+		defer func() {
+			g.done = true
+			if r := recover(); r != nil {
+				s.fail(fmt.Errorf("sched: goroutine %s panicked: %v", g.name, r))
+			}
+		}()
+		fn()
+	}()
+}
+
+// Yield 让出点：把执行权交还给调度器，由调度器决定下一个运行的虚拟 goroutine
+func (s *Scheduler) Yield() {
+	if s.aborting {
+		runtime.Goexit() // 被放弃的虚拟 goroutine 在 defer 中让出
+	}
+	g := s.current
+	s.events <- struct{}{}
+	if !<-g.resume {
+		runtime.Goexit() // 运行被放弃，执行 defer 之后退出
+	}
+}
+
+// Errorf 报告一个失败，调度器停止运行，Result.Err 为这个错误
+func (s *Scheduler) Errorf(format string, args ...interface{}) {
+	s.fail(fmt.Errorf(format, args...))
+	s.Yield()
+}
+
+// Assert cond 不成立时报告一个 ErrAssertion 失败
+func (s *Scheduler) Assert(cond bool, format string, args ...interface{}) {
+	if !cond {
+		s.Errorf("%w: %s", ErrAssertion, fmt.Sprintf(format, args...))
+	}
+}
+
+// Name 返回当前虚拟 goroutine 的名字
+func (s *Scheduler) Name() string {
+	return s.current.name
+}
+
+func (s *Scheduler) fail(err error) {
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// WaitUntil 阻塞当前虚拟 goroutine，直到 cond 返回 true
+// cond 已经为 true 时立即返回，不会让出。所有未结束的虚拟 goroutine 都在等待时报告 ErrDeadlock。
+func (s *Scheduler) WaitUntil(cond func() bool) {
+	if cond() {
+		return
+	}
+	g := s.current
+	g.until = cond
+	s.Yield()
+	g.until = nil
+}
+
+// Mutex 虚拟 goroutine 使用的互斥锁
+// Lock 是一个让出点；锁被持有时，虚拟 goroutine 被阻塞，直到锁被释放。
+type Mutex struct {
+	s      *Scheduler
+	locked bool
+}
+
+// NewMutex 返回一个属于 s 的 Mutex
+func (s *Scheduler) NewMutex() *Mutex {
+	return &Mutex{s: s}
+}
+
+// Lock 获取锁
+func (m *Mutex) Lock() {
+	m.s.Yield()
+	m.s.WaitUntil(func() bool { return !m.locked })
+	m.locked = true
+}
+
+// Unlock 释放锁，等待这个锁的虚拟 goroutine 由调度器决定谁先获取
+func (m *Mutex) Unlock() {
+	if !m.locked {
+		m.s.Errorf("sched: unlock of unlocked mutex")
+	}
+	m.locked = false
+}
+
+// WaitGroup 虚拟 goroutine 使用的 WaitGroup
+type WaitGroup struct {
+	s *Scheduler
+	n int
+}
+
+// NewWaitGroup 返回一个属于 s 的 WaitGroup
+func (s *Scheduler) NewWaitGroup() *WaitGroup {
+	return &WaitGroup{s: s}
+}
+
+// Add 和 sync.WaitGroup 一样，计数小于 0 时失败
+func (wg *WaitGroup) Add(delta int) {
+	wg.n += delta
+	if wg.n < 0 {
+		wg.s.Errorf("sched: negative WaitGroup counter")
+	}
+}
+
+// Done 计数减一
+func (wg *WaitGroup) Done() {
+	wg.Add(-1)
+}
+
+// Wait 阻塞直到计数为 0
+func (wg *WaitGroup) Wait() {
+	wg.s.WaitUntil(func() bool { return wg.n == 0 })
+}
+
+// Var 被多个虚拟 goroutine 共享的变量，每次访问之前都是一个让出点
+type Var[T any] struct {
+	s     *Scheduler
+	name  string
+	value T
+}
+
+// NewVar 返回一个属于 s、名为 name、初始值为 value 的 Var
+func NewVar[T any](s *Scheduler, name string, value T) *Var[T] {
+	return &Var[T]{s: s, name: name, value: value}
+}
+
+// Load 读取变量
+func (v *Var[T]) Load() T {
+	v.s.access(&access{v: v, name: v.name})
+	return v.value
+}
+
+// Store 写入变量
+func (v *Var[T]) Store(value T) {
+	v.s.access(&access{v: v, name: v.name, write: true})
+	v.value = value
+}
+
+func (s *Scheduler) access(a *access) {
+	g := s.current
+	g.access = a
+	s.Yield()
+	g.access = nil
+}
@@ -0,0 +1,278 @@
+package sched
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// counter 两个虚拟 goroutine 非原子地递增同一个变量，读和写之间是一个让出点
+func counter(s *Scheduler) {
+	var n int
+	wg := s.NewWaitGroup()
+	inc := func() {
+		defer wg.Done()
+		v := n
+		s.Yield()
+		n = v + 1
+	}
+	wg.Add(2)
+	s.Go("a", inc)
+	s.Go("b", inc)
+	wg.Wait()
+	if n != 2 {
+		s.Errorf("lost update: n = %d", n)
+	}
+}
+
+/*
+go test ./sched -v -count=1 -run TestRunDeterministic
+*/
+// TestRunDeterministic 相同的种子得到相同的交错执行
+func TestRunDeterministic(t *testing.T) {
+	for seed := int64(1); seed <= 20; seed++ {
+		first := Run(Config{Seed: seed}, counter)
+		second := Run(Config{Seed: seed}, counter)
+		if !reflect.DeepEqual(first, second) {
+			t.Fatalf("seed %d:\n%v\n%v", seed, first, second)
+		}
+	}
+}
+
+/*
+go test ./sched -v -count=1 -run TestExploreReplay
+*/
+// TestExploreReplay 随机探索找到丢失更新的种子，重放得到完全相同的执行和错误
+func TestExploreReplay(t *testing.T) {
+	failed, ok := Explore(100, counter)
+	if ok {
+		t.Fatal("no seed lost an update")
+	}
+	if !strings.Contains(failed.Err.Error(), "lost update") {
+		t.Fatalf("got %v", failed.Err)
+	}
+
+	replayed := Replay(failed, counter)
+	if !reflect.DeepEqual(replayed.Trace, failed.Trace) || replayed.Err.Error() != failed.Err.Error() {
+		t.Fatalf("replay differs:\n%v\n%v", failed, replayed)
+	}
+}
+
+/*
+go test ./sched -v -count=1 -run TestEnumerate
+*/
+// TestEnumerate 枚举所有的交错执行，每一次运行的调度序列都不相同
+func TestEnumerate(t *testing.T) {
+	seen := make(map[string]bool)
+	var failures int
+	runs := Enumerate(0, counter, func(r Result) bool {
+		key := strings.Join(r.Trace, " ")
+		if seen[key] {
+			t.Errorf("trace repeated: %s", key)
+		}
+		seen[key] = true
+		if r.Failed() {
+			failures++
+		}
+		return true
+	})
+	if runs != len(seen) || failures == 0 || failures == runs {
+		t.Fatalf("runs %d, distinct %d, failures %d", runs, len(seen), failures)
+	}
+
+	if got := Enumerate(3, counter, func(Result) bool { return true }); got != 3 {
+		t.Fatalf("limit 3 ran %d", got)
+	}
+}
+
+/*
+go test ./sched -v -count=1 -run TestMutex
+*/
+// TestMutex 使用 Mutex 之后所有的交错执行都不会丢失更新；相反的加锁顺序报告死锁
+func TestMutex(t *testing.T) {
+	Enumerate(0, func(s *Scheduler) {
+		var n int
+		m := s.NewMutex()
+		wg := s.NewWaitGroup()
+		inc := func() {
+			defer wg.Done()
+			m.Lock()
+			defer m.Unlock()
+			v := n
+			s.Yield()
+			n = v + 1
+		}
+		wg.Add(2)
+		s.Go("a", inc)
+		s.Go("b", inc)
+		wg.Wait()
+		if n != 2 {
+			s.Errorf("lost update: n = %d", n)
+		}
+	}, func(r Result) bool {
+		if r.Failed() {
+			t.Errorf("%v", r)
+		}
+		return true
+	})
+
+	deadlocks := 0
+	Enumerate(0, func(s *Scheduler) {
+		a, b := s.NewMutex(), s.NewMutex()
+		s.Go("ab", func() {
+			a.Lock()
+			b.Lock()
+			b.Unlock()
+			a.Unlock()
+		})
+		b.Lock()
+		a.Lock()
+		a.Unlock()
+		b.Unlock()
+	}, func(r Result) bool {
+		if errors.Is(r.Err, ErrDeadlock) {
+			deadlocks++
+		} else if r.Failed() {
+			t.Errorf("%v", r)
+		}
+		return true
+	})
+	if deadlocks == 0 {
+		t.Fatal("no deadlock found")
+	}
+}
+
+/*
+go test ./sched -v -count=1 -run TestFailures
+*/
+// TestFailures panic 和超过步数上限都是失败，其他的虚拟 goroutine 被放弃
+func TestFailures(t *testing.T) {
+	started, cleaned := false, false
+	r := Run(Config{}, func(s *Scheduler) {
+		s.Go("worker", func() {
+			started = true
+			defer func() { cleaned = true }()
+			for {
+				s.Yield()
+			}
+		})
+		s.WaitUntil(func() bool { return started })
+		panic("boom")
+	})
+	if r.Err == nil || !strings.Contains(r.Err.Error(), "main panicked: boom") || !cleaned {
+		t.Fatalf("got %v, cleaned %v", r, cleaned)
+	}
+
+	r = Run(Config{MaxSteps: 50}, func(s *Scheduler) {
+		for {
+			s.Yield()
+		}
+	})
+	if !errors.Is(r.Err, ErrStepLimit) {
+		t.Fatalf("got %v", r.Err)
+	}
+}
+
+/*
+go test ./sched -v -count=1 -run TestCheckPreemptionBound
+*/
+// TestCheckPreemptionBound 丢失更新需要一次抢占才能出现，上限越大运行的次数越多
+func TestCheckPreemptionBound(t *testing.T) {
+	runs := -1
+	for bound, wantFailed := range []bool{false, true, true} {
+		report := Check(CheckConfig{Preemptions: bound}, counter)
+		if !report.Complete || report.Failed() != wantFailed || report.Runs <= runs {
+			t.Fatalf("bound %d: %v", bound, report)
+		}
+		runs = report.Runs
+		for _, f := range report.Failures {
+			if f.Preemptions > bound {
+				t.Errorf("bound %d: %d preemptions", bound, f.Preemptions)
+			}
+		}
+	}
+	if unbounded := Check(CheckConfig{Preemptions: -1}, counter); unbounded.Runs < runs {
+		t.Fatalf("unbounded %d runs, bound 2 %d runs", unbounded.Runs, runs)
+	}
+}
+
+/*
+go test ./sched -v -count=1 -run TestCheckRace
+*/
+// TestCheckRace 没有同步地访问同一个 Var 报告数据竞争，使用 Mutex 保护之后没有失败
+func TestCheckRace(t *testing.T) {
+	body := func(locked bool) func(s *Scheduler) {
+		return func(s *Scheduler) {
+			data := NewVar(s, "data", 0)
+			m := s.NewMutex()
+			wg := s.NewWaitGroup()
+			wg.Add(1)
+			s.Go("writer", func() {
+				defer wg.Done()
+				if locked {
+					m.Lock()
+					defer m.Unlock()
+				}
+				data.Store(data.Load() + 1)
+			})
+			if locked {
+				m.Lock()
+			}
+			_ = data.Load()
+			if locked {
+				m.Unlock()
+			}
+			wg.Wait()
+			s.Assert(data.Load() == 1, "data = %d", data.Load())
+		}
+	}
+
+	report := Check(CheckConfig{Preemptions: 2}, body(false))
+	if !report.Failed() || !errors.Is(report.Failures[0].Err, ErrRace) {
+		t.Fatalf("got %v", report)
+	}
+	if !strings.Contains(report.Failures[0].Err.Error(), "on data") {
+		t.Fatalf("got %v", report.Failures[0].Err)
+	}
+	if replayed := Replay(report.Failures[0], body(false)); !errors.Is(replayed.Err, ErrRace) {
+		t.Fatalf("replay got %v", replayed)
+	}
+
+	if report := Check(CheckConfig{Preemptions: 2}, body(true)); report.Failed() || !report.Complete {
+		t.Fatalf("got %v", report)
+	}
+}
+
+/*
+go test ./sched -v -count=1 -run TestCheckAssert
+*/
+// TestCheckAssert 断言失败和死锁都被报告，每一种失败只报告第一次
+func TestCheckAssert(t *testing.T) {
+	report := Check(CheckConfig{Preemptions: 1}, func(s *Scheduler) {
+		a, b := s.NewMutex(), s.NewMutex()
+		s.Go("ba", func() {
+			b.Lock()
+			a.Lock()
+			a.Unlock()
+			b.Unlock()
+		})
+		a.Lock()
+		b.Lock()
+		s.Assert(false, "main holds both locks")
+	})
+	var deadlock, assertion int
+	for _, f := range report.Failures {
+		switch {
+		case errors.Is(f.Err, ErrDeadlock):
+			deadlock++
+		case errors.Is(f.Err, ErrAssertion):
+			assertion++
+		default:
+			t.Errorf("unexpected %v", f)
+		}
+	}
+	if deadlock != 1 || assertion != 1 {
+		t.Fatalf("got %v", report)
+	}
+}
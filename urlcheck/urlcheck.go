@@ -0,0 +1,175 @@
+// Package urlcheck 并发检查一组 URL 的状态
+// 第四章 errHandleExample 中 checkStatus 的完整实现：
+// 有界的 worker 池、每个请求的超时、失败重试、读取并关闭响应体，
+// 结果按照输入顺序或完成顺序以 pipeline.Result 流返回。
+package urlcheck
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"concurrency_in_go/pipeline"
+	"concurrency_in_go/ratelimit"
+)
+
+// maxDrain 关闭响应体前最多读取的字节数，读完响应体连接才能被复用
+const maxDrain = 64 << 10
+
+// Status 一个 URL 的检查结果
+type Status struct {
+	URL        string        // 请求的 URL
+	FinalURL   string        // 跟随重定向之后最终的 URL
+	StatusCode int           // 响应的状态码
+	Status     string        // 响应的状态，例如 "200 OK"
+	Attempts   int           // 请求的次数，包括重试
+	Duration   time.Duration // 所有请求花费的时间
+}
+
+// Checker 检查 URL 状态的 worker 池
+// 零值可以直接使用：一个 worker，不超时，不重试，按完成顺序返回。
+type Checker struct {
+	Client  *http.Client  // 为 nil 时使用 http.DefaultClient
+	Workers int           // 同时进行的请求数，小于 1 时按 1 处理
+	Timeout time.Duration // 每次请求的超时时间，0 表示不超时
+	Retries int           // 请求出错或者返回 5xx 时的重试次数
+	Backoff time.Duration // 两次重试之间的等待时间
+	Ordered bool          // 为 true 时按照 urls 的顺序返回结果
+
+	// Limiter 限制请求的速率，包括重试，为 nil 时不限制
+	Limiter ratelimit.Limiter
+}
+
+// Check 并发检查 urls，ctx 取消后停止所有请求并关闭返回的 channel
+// 请求出错时 Result.Err 不为 nil，Result.Value 中仍然包含 URL 和请求次数。
+func (c *Checker) Check(ctx context.Context, urls ...string) <-chan pipeline.Result[Status] {
+	workers := c.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	// 每个 URL 都有自己的结果槽，Ordered 时按顺序读取这些槽
+	slots := make([]chan pipeline.Result[Status], len(urls))
+	for i := range slots {
+		slots[i] = make(chan pipeline.Result[Status], 1)
+	}
+
+	results := make(chan pipeline.Result[Status])
+	indexes := pipeline.Generator(ctx.Done(), seq(len(urls))...)
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				result := c.check(ctx, urls[i])
+				if c.Ordered {
+					slots[i] <- result
+					continue
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case results <- result:
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(results)
+		defer wg.Wait() // 两种模式下都等所有 worker 退出之后才关闭 results
+		if !c.Ordered {
+			return
+		}
+		for _, slot := range slots {
+			select {
+			case <-ctx.Done():
+				return
+			case result := <-slot:
+				select {
+				case <-ctx.Done():
+					return
+				case results <- result:
+				}
+			}
+		}
+	}()
+	return results
+}
+
+// check 请求 url，按照 Retries 重试
+func (c *Checker) check(ctx context.Context, url string) pipeline.Result[Status] {
+	status := Status{URL: url}
+	start := time.Now()
+
+	var err error
+	for attempt := 0; attempt <= c.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				status.Duration = time.Since(start)
+				return pipeline.Result[Status]{Value: status, Err: ctx.Err()}
+			case <-time.After(c.Backoff):
+			}
+		}
+
+		if c.Limiter != nil {
+			if err = c.Limiter.Wait(ctx); err != nil {
+				break
+			}
+		}
+		status.Attempts++
+		err = c.do(ctx, &status)
+		if err == nil && status.StatusCode < http.StatusInternalServerError {
+			break
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	status.Duration = time.Since(start)
+	return pipeline.Result[Status]{Value: status, Err: err}
+}
+
+// do 发送一次请求，读取并关闭响应体
+func (c *Checker) do(ctx context.Context, status *Status) error {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, status.URL, nil)
+	if err != nil {
+		return fmt.Errorf("urlcheck: %w", err)
+	}
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrain))
+
+	status.FinalURL = resp.Request.URL.String()
+	status.StatusCode = resp.StatusCode
+	status.Status = resp.Status
+	return nil
+}
+
+func seq(n int) []int {
+	s := make([]int, n)
+	for i := range s {
+		s[i] = i
+	}
+	return s
+}
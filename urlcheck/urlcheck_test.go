@@ -0,0 +1,285 @@
+package urlcheck
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"concurrency_in_go/pipeline"
+	"concurrency_in_go/ratelimit"
+)
+
+// newServer 启动一个模拟各种情况的本地服务器
+//
+//	/ok        返回 200
+//	/slow      等待 200ms 后返回 200
+//	/fail      返回 500
+//	/flaky     前两次返回 503，之后返回 200
+//	/redirect  重定向到 /ok
+//	/delay/N   等待 N 毫秒后返回 200
+func newServer(t *testing.T) *httptest.Server {
+	var flaky int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 1024)))
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+	})
+	mux.HandleFunc("/fail", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	mux.HandleFunc("/flaky", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&flaky, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ok", http.StatusFound)
+	})
+	mux.HandleFunc("/delay/", func(w http.ResponseWriter, r *http.Request) {
+		d, _ := time.ParseDuration(strings.TrimPrefix(r.URL.Path, "/delay/") + "ms")
+		time.Sleep(d)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func collect(results <-chan pipeline.Result[Status]) []pipeline.Result[Status] {
+	var all []pipeline.Result[Status]
+	for r := range results {
+		all = append(all, r)
+	}
+	return all
+}
+
+/*
+go test ./urlcheck -v -count=1 -run TestCheck
+*/
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	server := newServer(t)
+	checker := Checker{Client: server.Client(), Workers: 4, Timeout: 100 * time.Millisecond}
+
+	results := collect(checker.Check(context.Background(),
+		server.URL+"/ok", server.URL+"/slow", server.URL+"/fail", server.URL+"/redirect", "://badurl"))
+	if len(results) != 5 {
+		t.Fatalf("got %d results, want 5", len(results))
+	}
+
+	byURL := make(map[string]pipeline.Result[Status])
+	for _, r := range results {
+		byURL[strings.TrimPrefix(r.Value.URL, server.URL)] = r
+	}
+	if r := byURL["/ok"]; r.Err != nil || r.Value.StatusCode != http.StatusOK {
+		t.Errorf("/ok: %+v", r)
+	}
+	if r := byURL["/slow"]; !errors.Is(r.Err, context.DeadlineExceeded) {
+		t.Errorf("/slow should time out: %+v", r)
+	}
+	if r := byURL["/fail"]; r.Err != nil || r.Value.StatusCode != http.StatusInternalServerError {
+		t.Errorf("/fail: %+v", r)
+	}
+	if r := byURL["/redirect"]; r.Err != nil || r.Value.FinalURL != server.URL+"/ok" {
+		t.Errorf("/redirect: %+v", r)
+	}
+	if r := byURL["://badurl"]; r.Err == nil {
+		t.Errorf("://badurl should fail: %+v", r)
+	}
+}
+
+/*
+go test ./urlcheck -v -count=1 -run TestCheckRetry
+*/
+func TestCheckRetry(t *testing.T) {
+	t.Parallel()
+
+	server := newServer(t)
+	checker := Checker{Client: server.Client(), Retries: 3, Backoff: time.Millisecond}
+
+	r := <-checker.Check(context.Background(), server.URL+"/flaky")
+	if r.Err != nil || r.Value.StatusCode != http.StatusOK || r.Value.Attempts != 3 {
+		t.Fatalf("got %+v", r)
+	}
+
+	r = <-checker.Check(context.Background(), server.URL+"/fail")
+	if r.Value.StatusCode != http.StatusInternalServerError || r.Value.Attempts != 4 {
+		t.Fatalf("got %+v", r)
+	}
+}
+
+/*
+go test ./urlcheck -v -count=1 -run TestCheckLimiter
+*/
+// TestCheckLimiter 所有 worker 共享同一个 Limiter，请求总数受到速率的限制
+func TestCheckLimiter(t *testing.T) {
+	t.Parallel()
+
+	server := newServer(t)
+	checker := Checker{Client: server.Client(), Workers: 4, Limiter: ratelimit.NewTokenBucket(ratelimit.Per(100, time.Second), 1)}
+	urls := []string{server.URL + "/ok", server.URL + "/ok", server.URL + "/ok", server.URL + "/ok", server.URL + "/ok"}
+
+	start := time.Now()
+	for _, r := range collect(checker.Check(context.Background(), urls...)) {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+	}
+	// 突发为 1，之后每 10ms 一个令牌，5 个请求理论上至少需要 40ms，留出 5ms 的计时误差
+	if elapsed := time.Since(start); elapsed < 35*time.Millisecond {
+		t.Fatalf("5 requests took %v, want at least 35ms", elapsed)
+	}
+}
+
+/*
+go test ./urlcheck -v -count=1 -run TestCheckOrdered
+*/
+func TestCheckOrdered(t *testing.T) {
+	t.Parallel()
+
+	server := newServer(t)
+	// 越靠前的 URL 越慢，按完成顺序返回时顺序会被打乱
+	urls := []string{
+		server.URL + "/delay/80", server.URL + "/delay/60", server.URL + "/delay/40",
+		server.URL + "/delay/20", server.URL + "/delay/0",
+	}
+
+	ordered := Checker{Client: server.Client(), Workers: len(urls), Ordered: true}
+	for i, r := range collect(ordered.Check(context.Background(), urls...)) {
+		if r.Value.URL != urls[i] {
+			t.Fatalf("result %d: got %s, want %s", i, r.Value.URL, urls[i])
+		}
+	}
+
+	unordered := Checker{Client: server.Client(), Workers: len(urls)}
+	results := collect(unordered.Check(context.Background(), urls...))
+	if len(results) != len(urls) || results[0].Value.URL != urls[len(urls)-1] {
+		t.Fatalf("unordered check should return the fastest url first, got %s", results[0].Value.URL)
+	}
+}
+
+/*
+go test ./urlcheck -v -count=1 -run TestCheckWorkers
+*/
+// TestCheckWorkers 同时进行的请求数不超过 Workers，
+// 响应体被读完并关闭后连接可以复用，每个 worker 只需要建立一个连接。
+func TestCheckWorkers(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var inFlight, maxInFlight, conns int
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+		w.Write([]byte(strings.Repeat("x", 4096)))
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			conns++
+			mu.Unlock()
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	urls := make([]string, 20)
+	for i := range urls {
+		urls[i] = server.URL
+	}
+
+	checker := Checker{Client: server.Client(), Workers: 2}
+	if results := collect(checker.Check(context.Background(), urls...)); len(results) != len(urls) {
+		t.Fatalf("got %d results, want %d", len(results), len(urls))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if maxInFlight > 2 {
+		t.Errorf("max in-flight requests = %d, want <= 2", maxInFlight)
+	}
+	if conns > 2 {
+		t.Errorf("opened %d connections, want <= 2", conns)
+	}
+}
+
+/*
+go test ./urlcheck -v -count=1 -run TestCheckCancel
+*/
+func TestCheckCancel(t *testing.T) {
+	t.Parallel()
+
+	server := newServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	checker := Checker{Client: server.Client(), Workers: 2, Ordered: true}
+	results := checker.Check(ctx, server.URL+"/ok", server.URL+"/slow", server.URL+"/slow", server.URL+"/slow")
+	<-results
+	cancel()
+
+	start := time.Now()
+	collect(results)
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("check did not stop after cancel, took %v", elapsed)
+	}
+}
+
+// roundTripFunc 把函数用作 http.RoundTripper
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+/*
+go test ./urlcheck -v -count=1 -run TestCheckCancelWaitsForWorkers
+*/
+// TestCheckCancelWaitsForWorkers 取消之后 results 关闭时，所有 worker 都已经退出，没有请求还在进行
+func TestCheckCancelWaitsForWorkers(t *testing.T) {
+	t.Parallel()
+
+	for _, ordered := range []bool{false, true} {
+		var inFlight int32
+		started := make(chan struct{}, 4)
+		client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			atomic.AddInt32(&inFlight, 1)
+			defer atomic.AddInt32(&inFlight, -1)
+			started <- struct{}{}
+			<-r.Context().Done()
+			time.Sleep(20 * time.Millisecond) // 取消之后还需要一段时间才能返回
+			return nil, r.Context().Err()
+		})}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		checker := Checker{Client: client, Workers: 2, Ordered: ordered}
+		results := checker.Check(ctx, "http://a", "http://b", "http://c", "http://d")
+		<-started
+		<-started
+		cancel()
+		collect(results)
+		if n := atomic.LoadInt32(&inFlight); n != 0 {
+			t.Fatalf("ordered %v: %d requests still in flight after results closed", ordered, n)
+		}
+	}
+}